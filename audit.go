@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An AuditEntry records a single command: who issued it, when and where,
+// what sked said back, and whether it changed the state. The audit log is
+// a file of AuditEntries, one JSON object per line.
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	User     string    `json:"user,omitempty"`
+	Channel  string    `json:"channel,omitempty"`
+	Rotation string    `json:"rotation,omitempty"`
+	Action   string    `json:"action"`
+	Args     []string  `json:"args"`
+	Response string    `json:"response"`
+	Changed  bool      `json:"changed"`
+}
+
+func (e AuditEntry) String() string {
+	response := strings.Trim(strings.SplitN(strings.Trim(e.Response, "`\n"), "\n", 2)[0], "`")
+	if len(response) > 80 {
+		response = response[:77] + "..."
+	}
+	who := "someone"
+	if e.User != "" {
+		who = "<@" + e.User + ">"
+	}
+	where := ""
+	if e.Channel != "" {
+		where = " in <#" + e.Channel + ">"
+	}
+	changed := ""
+	if e.Changed {
+		changed = " (changed)"
+	}
+	words := append([]string{e.Action}, e.Args...)
+	if e.Rotation != "" {
+		words = append([]string{e.Rotation}, words...)
+	}
+	return fmt.Sprintf("%v %v%v: %v -> %v%v", e.Time.Format(TIME_FORMAT), who, where,
+		strings.Join(words, " "), response, changed)
+}
+
+// An AuditLog appends AuditEntries to a file, flushing each one as it is
+// written so that nothing is lost if sked dies.
+type AuditLog struct {
+	filename string
+	f        *os.File
+	w        *bufio.Writer
+	lock     sync.Mutex
+}
+
+func OpenAuditLog(filename string) (*AuditLog, error) {
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{filename: filename, f: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (a *AuditLog) Write(e AuditEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	_, err = a.w.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+	return a.w.Flush()
+}
+
+// Recent returns the last n entries in the log, oldest first.
+func (a *AuditLog) Recent(n int) ([]AuditEntry, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	f, err := os.Open(a.filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries := []AuditEntry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		entries = append(entries, parseLogEntry(scanner.Text()))
+		if len(entries) > n {
+			entries = entries[1:]
+		}
+	}
+	return entries, scanner.Err()
+}
+
+func (a *AuditLog) Close() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.w.Flush()
+	return a.f.Close()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	inChicago(t)
+	a, err := OpenAuditLog(filepath.Join(t.TempDir(), "sked-log.txt"))
+	if err != nil {
+		t.Fatalf("Couldn't open audit log: %v", err)
+	}
+	defer a.Close()
+
+	loc, _ := time.LoadLocation("America/Chicago")
+	at := time.Date(2015, time.October, 11, 22, 3, 0, 0, loc)
+	for i, name := range []string{"joe", "bob", "sue"} {
+		err = a.Write(AuditEntry{
+			Time:     at.Add(time.Minute * time.Duration(i)),
+			User:     "U123",
+			Channel:  "C456",
+			Action:   "add",
+			Args:     []string{name},
+			Response: name + " add with ordering 0",
+			Changed:  true,
+		})
+		if err != nil {
+			t.Fatalf("Couldn't write to audit log: %v", err)
+		}
+	}
+
+	entries, err := a.Recent(2)
+	if err != nil {
+		t.Fatalf("Couldn't read audit log: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Args[0] != "bob" || entries[1].Args[0] != "sue" {
+		t.Fatalf("Expected the last two entries, got: %v", entries)
+	}
+
+	s := NewState(time.Wednesday)
+	s.audit = a
+	msg := auditCmd(command{action: "audit", args: []string{"1"}}, s)
+	if msg != "Sun Oct 11 22:05 CDT <@U123> in <#C456>: add sue -> sue add with ordering 0 (changed)" {
+		t.Fatalf("Unexpected audit output: %v", msg)
+	}
+	if !strings.Contains(auditCmd(command{action: "audit", args: []string{"x"}}, s), "Couldn't understand") {
+		t.Fatalf("audit should complain about a bad number")
+	}
+}
@@ -0,0 +1,560 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// The buckets a boltStore keeps the state in
+var (
+	// "version" and "default" rotation
+	metaBucket = []byte("meta")
+	// Person by name, without their unavailability
+	peopleBucket = []byte("people")
+	// A bucket per person of their unavailability by ID
+	unavailabilityBucket = []byte("unavailability")
+	// Rotation by name, without its schedule
+	rotationsBucket = []byte("rotations")
+	// A bucket per rotation with a schedule, of its shifts by start time
+	shiftsBucket = []byte("shifts")
+	// ShiftRecord by its place in State.History
+	historyBucket = []byte("history")
+	// Holiday by date
+	holidaysBucket = []byte("holidays")
+	// When each reminder was sent, by reminder key
+	remindersBucket = []byte("reminders")
+)
+
+// errNothingSaved is what Load returns for a database nothing has been
+// saved in yet, as opposed to one it can't read.
+var errNothingSaved = errors.New("Nothing has been saved in the database yet")
+
+// A boltStore keeps the state in a bbolt database, with each person,
+// shift, history record and so on as a separate record. Each save happens
+// in a single transaction, so the state on disk is always whole. Only the
+// people and rotations the state has marked as changed are saved, and of
+// the rest, history is only ever appended to, so only its new records are
+// written.
+type boltStore struct {
+	db *bolt.DB
+	// Whether the database holds what the state had when it was last
+	// saved or loaded, so only what's changed since needs saving
+	current bool
+	// How many records the last Save wrote or deleted
+	written int
+}
+
+// A savedShift is how a shift is saved - with just the name of its
+// worker, who is linked back up on load.
+type savedShift struct {
+	Worker string
+	Start  time.Time
+	End    time.Time
+	Change string
+}
+
+// OpenBoltStore opens or creates the database at path. Only one process
+// can have it open at once.
+func OpenBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't open %v: %v", path, err)
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (b *boltStore) Close() error {
+	return b.db.Close()
+}
+
+// Save writes the records in s which have been marked as changed since it
+// was last saved, and deletes the ones which are no longer in s. The first
+// time, when the database could have anything in it, it goes through every
+// record instead. Either way a record which is the same as the one in the
+// database isn't written.
+func (b *boltStore) Save(s *State) error {
+	b.written = 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		meta := map[string][]byte{
+			"version": []byte(strconv.Itoa(STATE_VERSION)),
+			"default": []byte(s.DefaultRotation),
+		}
+		if err := b.sync(tx, metaBucket, meta); err != nil {
+			return err
+		}
+
+		people, rotations, other := s.changes.people, s.changes.rotations, s.changes.other
+		if !b.current {
+			people = make(map[string]bool)
+			for name := range s.People {
+				people[name] = true
+			}
+			rotations = make(map[string]bool)
+			for name := range s.Rotations {
+				rotations[name] = true
+			}
+			for _, name := range [][]byte{peopleBucket, unavailabilityBucket} {
+				addKeys(tx.Bucket(name), people)
+			}
+			for _, name := range [][]byte{rotationsBucket, shiftsBucket} {
+				addKeys(tx.Bucket(name), rotations)
+			}
+			other = true
+		}
+		for name := range people {
+			if err := b.savePerson(tx, name, s.People[name]); err != nil {
+				return err
+			}
+		}
+		for name := range rotations {
+			if err := b.saveRotation(tx, name, s.Rotations[name]); err != nil {
+				return err
+			}
+		}
+		if !other {
+			return nil
+		}
+
+		if err := b.saveHistory(tx, s.History); err != nil {
+			return err
+		}
+
+		holidays := make(map[string][]byte)
+		for _, h := range s.Holidays {
+			if err := marshalRecord(holidays, h.Date.Format("2006-01-02"), h); err != nil {
+				return err
+			}
+		}
+		if err := b.sync(tx, holidaysBucket, holidays); err != nil {
+			return err
+		}
+
+		reminders := make(map[string][]byte)
+		for key, sent := range s.SentReminders {
+			if err := marshalRecord(reminders, key, sent); err != nil {
+				return err
+			}
+		}
+		return b.sync(tx, remindersBucket, reminders)
+	})
+	if err != nil {
+		return err
+	}
+	b.current = true
+	s.saved()
+	return nil
+}
+
+// savePerson writes the person called name, with their unavailability, or
+// deletes them if p is nil.
+func (b *boltStore) savePerson(tx *bolt.Tx, name string, p *Person) error {
+	var person interface{}
+	records := make(map[string][]byte)
+	if p != nil {
+		saved := *p
+		saved.Unavailability = nil
+		person = saved
+		for _, u := range p.Unavailability {
+			if err := marshalRecord(records, indexKey(u.(*Unavailable).ID), u); err != nil {
+				return err
+			}
+		}
+	}
+	return b.saveRecord(tx, peopleBucket, unavailabilityBucket, name, person, records)
+}
+
+// saveRotation writes the rotation called name, with its schedule, or
+// deletes it if r is nil.
+func (b *boltStore) saveRotation(tx *bolt.Tx, name string, r *Rotation) error {
+	var rotation interface{}
+	var records map[string][]byte
+	if r != nil {
+		saved := *r
+		saved.Schedule = nil
+		rotation = saved
+		if r.Schedule != nil {
+			records = make(map[string][]byte)
+			for _, shift := range r.Schedule.ShiftsList {
+				saved := savedShift{shift.Worker().Identifier(), shift.Start(), shift.End(), shift.Change}
+				if err := marshalRecord(records, timeKey(shift.Start()), saved); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return b.saveRecord(tx, rotationsBucket, shiftsBucket, name, rotation, records)
+}
+
+// saveRecord writes value under key in the bucket called name, and makes
+// key's bucket in the bucket called nested hold exactly records. A nil
+// value deletes both, and nil records deletes just the nested bucket.
+func (b *boltStore) saveRecord(tx *bolt.Tx, name []byte, nested []byte, key string, value interface{}, records map[string][]byte) error {
+	bucket, err := tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return err
+	}
+	parent, err := tx.CreateBucketIfNotExists(nested)
+	if err != nil {
+		return err
+	}
+	if value == nil || records == nil {
+		if parent.Bucket([]byte(key)) != nil {
+			if err := parent.DeleteBucket([]byte(key)); err != nil {
+				return err
+			}
+			b.written += 1
+		}
+	} else {
+		group, err := parent.CreateBucketIfNotExists([]byte(key))
+		if err != nil {
+			return err
+		}
+		if err := b.syncBucket(group, records); err != nil {
+			return err
+		}
+	}
+	if value == nil {
+		if bucket.Get([]byte(key)) == nil {
+			return nil
+		}
+		b.written += 1
+		return bucket.Delete([]byte(key))
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return b.put(bucket, []byte(key), data)
+}
+
+// addKeys adds the keys in bucket, if it exists, to keys.
+func addKeys(bucket *bolt.Bucket, keys map[string]bool) {
+	if bucket == nil {
+		return
+	}
+	bucket.ForEach(func(k, v []byte) error {
+		keys[string(k)] = true
+		return nil
+	})
+}
+
+// saveHistory appends the records in history which haven't been saved yet.
+// History is only ever appended to, so only if it's somehow shrunk is it
+// all written again.
+func (b *boltStore) saveHistory(tx *bolt.Tx, history []*ShiftRecord) error {
+	bucket, err := tx.CreateBucketIfNotExists(historyBucket)
+	if err != nil {
+		return err
+	}
+	saved := bucket.Sequence()
+	if uint64(len(history)) < saved {
+		records := make(map[string][]byte)
+		for i, record := range history {
+			if err := marshalRecord(records, indexKey(i), record); err != nil {
+				return err
+			}
+		}
+		if err := b.sync(tx, historyBucket, records); err != nil {
+			return err
+		}
+		return bucket.SetSequence(uint64(len(history)))
+	}
+	for i := int(saved); i < len(history); i++ {
+		value, err := json.Marshal(history[i])
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put([]byte(indexKey(i)), value); err != nil {
+			return err
+		}
+		b.written += 1
+	}
+	return bucket.SetSequence(uint64(len(history)))
+}
+
+// sync makes the bucket called name hold exactly records, only writing
+// the ones which are different.
+func (b *boltStore) sync(tx *bolt.Tx, name []byte, records map[string][]byte) error {
+	bucket, err := tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return err
+	}
+	return b.syncBucket(bucket, records)
+}
+
+func (b *boltStore) syncBucket(bucket *bolt.Bucket, records map[string][]byte) error {
+	stale := [][]byte{}
+	err := bucket.ForEach(func(k, v []byte) error {
+		if _, ok := records[string(k)]; !ok {
+			stale = append(stale, append([]byte{}, k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range stale {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+		b.written += 1
+	}
+	for k, v := range records {
+		if err := b.put(bucket, []byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// put writes value under key in bucket, unless it's already there.
+func (b *boltStore) put(bucket *bolt.Bucket, key []byte, value []byte) error {
+	if bytes.Equal(bucket.Get(key), value) {
+		return nil
+	}
+	b.written += 1
+	return bucket.Put(key, value)
+}
+
+func (b *boltStore) Load(s *State) error {
+	upgraded := false
+	err := b.db.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if meta == nil {
+			return errNothingSaved
+		}
+		version, err := strconv.Atoi(string(meta.Get([]byte("version"))))
+		if err != nil {
+			return fmt.Errorf("The database has no version: %v", err)
+		}
+		if version > STATE_VERSION {
+			return fmt.Errorf("The database is version %v, but this sked only understands up to version %v", version, STATE_VERSION)
+		}
+		if version < STATE_VERSION {
+			upgraded = true
+			return b.loadOlder(tx, s, version)
+		}
+		s.DefaultRotation = string(meta.Get([]byte("default")))
+
+		s.People = make(map[string]*Person)
+		err = forEachRecord(tx.Bucket(peopleBucket), func() interface{} { return &Person{} }, func(k string, v interface{}) {
+			s.People[k] = v.(*Person)
+		})
+		if err != nil {
+			return err
+		}
+		if unavailability := tx.Bucket(unavailabilityBucket); unavailability != nil {
+			for name, p := range s.People {
+				err = forEachRecord(unavailability.Bucket([]byte(name)), func() interface{} { return &Unavailable{} }, func(k string, v interface{}) {
+					p.Unavailability = append(p.Unavailability, v.(*Unavailable))
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		s.Rotations = make(map[string]*Rotation)
+		err = forEachRecord(tx.Bucket(rotationsBucket), func() interface{} { return &Rotation{} }, func(k string, v interface{}) {
+			s.Rotations[k] = v.(*Rotation)
+		})
+		if err != nil {
+			return err
+		}
+		if shifts := tx.Bucket(shiftsBucket); shifts != nil {
+			for name, r := range s.Rotations {
+				bucket := shifts.Bucket([]byte(name))
+				if bucket == nil {
+					continue
+				}
+				r.Schedule = &Schedule{ShiftsList: []*Shift{}}
+				err = forEachRecord(bucket, func() interface{} { return &savedShift{} }, func(k string, v interface{}) {
+					saved := v.(*savedShift)
+					shift := &Shift{Interval: &Interval{saved.Start, saved.End}, WorkerThing: NewPerson(saved.Worker), Change: saved.Change}
+					r.Schedule.ShiftsList = append(r.Schedule.ShiftsList, shift)
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		s.History = nil
+		err = forEachRecord(tx.Bucket(historyBucket), func() interface{} { return &ShiftRecord{} }, func(k string, v interface{}) {
+			s.History = append(s.History, v.(*ShiftRecord))
+		})
+		if err != nil {
+			return err
+		}
+
+		s.Holidays = nil
+		err = forEachRecord(tx.Bucket(holidaysBucket), func() interface{} { return &Holiday{} }, func(k string, v interface{}) {
+			s.Holidays = append(s.Holidays, *v.(*Holiday))
+		})
+		if err != nil {
+			return err
+		}
+
+		s.SentReminders = make(map[string]time.Time)
+		err = forEachRecord(tx.Bucket(remindersBucket), func() interface{} { return &time.Time{} }, func(k string, v interface{}) {
+			s.SentReminders[k] = *v.(*time.Time)
+		})
+		if err != nil {
+			return err
+		}
+		s.relink()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if upgraded {
+		// rewrite every record in the current version
+		b.current = false
+		return b.Save(s)
+	}
+	b.current = true
+	s.saved()
+	return nil
+}
+
+// loadOlder loads s from a database saved in an older version of the
+// format. Its records are put back together the way the state file has
+// them, so that stateMigrations can upgrade it the same way.
+func (b *boltStore) loadOlder(tx *bolt.Tx, s *State, version int) error {
+	people := make(map[string]interface{})
+	err := forEachRecord(tx.Bucket(peopleBucket), newValues, func(k string, v interface{}) {
+		people[k] = *v.(*map[string]interface{})
+	})
+	if err != nil {
+		return err
+	}
+	if unavailability := tx.Bucket(unavailabilityBucket); unavailability != nil {
+		for name, p := range people {
+			list, err := recordList(unavailability.Bucket([]byte(name)), newValues)
+			if err != nil {
+				return err
+			}
+			p.(map[string]interface{})["Unavailability"] = list
+		}
+	}
+
+	rotations := make(map[string]interface{})
+	err = forEachRecord(tx.Bucket(rotationsBucket), newValues, func(k string, v interface{}) {
+		rotations[k] = *v.(*map[string]interface{})
+	})
+	if err != nil {
+		return err
+	}
+	if shifts := tx.Bucket(shiftsBucket); shifts != nil {
+		for name, r := range rotations {
+			bucket := shifts.Bucket([]byte(name))
+			if bucket == nil {
+				continue
+			}
+			list := []interface{}{}
+			err = forEachRecord(bucket, func() interface{} { return &savedShift{} }, func(k string, v interface{}) {
+				saved := v.(*savedShift)
+				list = append(list, &Shift{Interval: &Interval{saved.Start, saved.End}, WorkerThing: NewPerson(saved.Worker), Change: saved.Change})
+			})
+			if err != nil {
+				return err
+			}
+			r.(map[string]interface{})["Schedule"] = map[string]interface{}{"ShiftsList": list}
+		}
+	}
+
+	history, err := recordList(tx.Bucket(historyBucket), newValues)
+	if err != nil {
+		return err
+	}
+	holidays, err := recordList(tx.Bucket(holidaysBucket), newValues)
+	if err != nil {
+		return err
+	}
+	reminders := make(map[string]interface{})
+	err = forEachRecord(tx.Bucket(remindersBucket), func() interface{} { return new(interface{}) }, func(k string, v interface{}) {
+		reminders[k] = *v.(*interface{})
+	})
+	if err != nil {
+		return err
+	}
+
+	state, err := json.Marshal(map[string]interface{}{
+		"People":          people,
+		"Rotations":       rotations,
+		"DefaultRotation": string(tx.Bucket(metaBucket).Get([]byte("default"))),
+		"SentReminders":   reminders,
+		"History":         history,
+		"Holidays":        holidays,
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.decodeState(version, state); err != nil {
+		return err
+	}
+	s.relink()
+	return nil
+}
+
+// newValues is a new record as plain JSON values, for loadOlder.
+func newValues() interface{} {
+	return &map[string]interface{}{}
+}
+
+// recordList decodes each record in bucket, in key order, into a list.
+func recordList(bucket *bolt.Bucket, newValue func() interface{}) ([]interface{}, error) {
+	list := []interface{}{}
+	err := forEachRecord(bucket, newValue, func(k string, v interface{}) {
+		list = append(list, v)
+	})
+	return list, err
+}
+
+// forEachRecord decodes each record in bucket, in key order, into a new
+// value from newValue and passes it to f. A bucket which doesn't exist has no
+// records.
+func forEachRecord(bucket *bolt.Bucket, newValue func() interface{}, f func(key string, value interface{})) error {
+	if bucket == nil {
+		return nil
+	}
+	return bucket.ForEach(func(k, v []byte) error {
+		value := newValue()
+		if err := json.Unmarshal(v, value); err != nil {
+			return fmt.Errorf("Couldn't read the record %q: %v", k, err)
+		}
+		f(string(k), value)
+		return nil
+	})
+}
+
+func marshalRecord(records map[string][]byte, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	records[key] = data
+	return nil
+}
+
+// indexKey is a key for the ith of a list, which sorts in order.
+func indexKey(i int) string {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(i))
+	return string(key)
+}
+
+// timeKey is a key for t, which sorts in order.
+func timeKey(t time.Time) string {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return string(key)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltStore(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, time.October, 11, 22, 0, 0, 0, loc)
+	end := time.Date(2015, time.November, 18, 17, 0, 0, 0, loc)
+	path := filepath.Join(t.TempDir(), "sked.db")
+
+	store, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewState(time.Wednesday)
+	s.SetStore(store)
+	if err := s.Populate(); err != errNothingSaved {
+		t.Fatalf("There's nothing to populate from yet, got: %v", err)
+	}
+	s.AddPerson("joe", 0)
+	s.AddPerson("bob", 1)
+	s.People["bob"].AddUnavailable(&Interval{start, start.Add(time.Hour * 24)})
+	s.People["joe"].AddPreference(&Interval{start, start.Add(time.Hour)}, true)
+	s.AddHoliday(start, "Some holiday")
+	s.Default().Schedule = s.BuildSchedule(start, end)
+	s.CommitShifts(start.AddDate(0, 0, 3))
+	s.SentReminders["a reminder"] = start
+	if err := s.Persist(); err != nil {
+		t.Fatalf("Couldn't persist: %v", err)
+	}
+
+	if err := s.Persist(); err != nil || store.written != 0 {
+		t.Fatalf("Nothing changed so nothing should have been written, wrote %v, err: %v", store.written, err)
+	}
+	s.People["joe"].TZ = "Europe/London"
+	s.personChanged("joe")
+	if err := s.Persist(); err != nil || store.written != 1 {
+		t.Fatalf("Only joe should have been written, wrote %v, err: %v", store.written, err)
+	}
+	s.People["bob"].RemoveUnavailable(s.People["bob"].Unavailability[0].(*Unavailable).ID)
+	// which will load as nil
+	s.People["bob"].Unavailability = nil
+	s.personChanged("bob")
+	if err := s.Persist(); err != nil || store.written != 1 {
+		t.Fatalf("Only bob's unavailability should have been removed, wrote %v, err: %v", store.written, err)
+	}
+	// one more shift in the history, and the rotation's CommittedUntil
+	s.CommitShifts(start.AddDate(0, 0, 10))
+	if err := s.Persist(); err != nil || store.written != 2 || len(s.History) != 2 {
+		t.Fatalf("Only the new history record and the rotation should have been written, wrote %v, err: %v", store.written, err)
+	}
+	store.Close()
+
+	store, err = OpenBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	loaded := NewState(time.Monday)
+	loaded.SetStore(store)
+	if err := loaded.Populate(); err != nil {
+		t.Fatalf("Couldn't populate: %v", err)
+	}
+	if !bytes.Equal(s.digest(), loaded.digest()) {
+		t.Fatalf("The state changed on the way through:\n%s\n%s", s.digest(), loaded.digest())
+	}
+	shift := loaded.Default().Schedule.ShiftsList[0]
+	if shift.Worker() != loaded.People[shift.Worker().Identifier()] {
+		t.Fatalf("Shifts should be worked by the people in the state, not copies")
+	}
+
+	// a database from a newer sked has something in it, it just can't be read
+	store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).Put([]byte("version"), []byte("99"))
+	})
+	if err := loaded.Populate(); err == nil || err == errNothingSaved {
+		t.Fatalf("A newer database shouldn't load, got: %v", err)
+	}
+}
+
+func TestBoltStoreVersions(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, time.October, 11, 22, 0, 0, 0, loc)
+	end := time.Date(2015, time.November, 18, 17, 0, 0, 0, loc)
+	store, err := OpenBoltStore(filepath.Join(t.TempDir(), "sked.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	s := NewState(time.Wednesday)
+	s.SetStore(store)
+	s.AddPerson("joe", 0)
+	s.People["joe"].AddUnavailable(&Interval{end, end.Add(time.Hour * 24)})
+	s.Default().Schedule = s.BuildSchedule(start, end)
+	s.CommitShifts(start.AddDate(0, 0, 3))
+	if err := s.Persist(); err != nil {
+		t.Fatalf("Couldn't persist: %v", err)
+	}
+
+	// a made up version 0 which called time zones "Zone"
+	store.db.Update(func(tx *bolt.Tx) error {
+		tx.Bucket(metaBucket).Put([]byte("version"), []byte("0"))
+		return tx.Bucket(peopleBucket).Put([]byte("joe"), []byte(`{"Name": "joe", "Zone": "Europe/London", "LastID": 1}`))
+	})
+	loaded := NewState(time.Wednesday)
+	loaded.SetStore(store)
+	if err := loaded.Populate(); err == nil {
+		t.Fatalf("There's no migration from version 0")
+	}
+	stateMigrations[0] = func(state map[string]interface{}) error {
+		for _, p := range state["People"].(map[string]interface{}) {
+			person := p.(map[string]interface{})
+			person["TZ"] = person["Zone"]
+			delete(person, "Zone")
+		}
+		return nil
+	}
+	defer delete(stateMigrations, 0)
+	if err := loaded.Populate(); err != nil {
+		t.Fatalf("Couldn't populate: %v", err)
+	}
+	joe := loaded.People["joe"]
+	if joe.TZ != "Europe/London" || len(joe.Unavailability) != 1 || len(loaded.History) != 1 {
+		t.Fatalf("The database wasn't upgraded properly: %v, %v", joe, loaded.History)
+	}
+	for i, shift := range s.Default().Schedule.ShiftsList {
+		if got := loaded.Default().Schedule.ShiftsList[i]; !got.Start().Equal(shift.Start()) || !got.End().Equal(shift.End()) {
+			t.Fatalf("The schedule changed on the way through:\n%v\n%v", s.Default().Schedule, loaded.Default().Schedule)
+		}
+	}
+	shift := loaded.Default().Schedule.ShiftsList[0]
+	if shift.Worker() != joe {
+		t.Fatalf("Shifts should be worked by the people in the state, not copies")
+	}
+
+	// and saved back in the current version
+	delete(stateMigrations, 0)
+	again := NewState(time.Wednesday)
+	again.SetStore(store)
+	if err := again.Populate(); err != nil || again.People["joe"].TZ != "Europe/London" {
+		t.Fatalf("The upgraded database should load without any migrations: %v", err)
+	}
+}
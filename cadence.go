@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The longest a shift can be, in days
+const MAX_CADENCE_DAYS = 365
+
+// A ShiftGenerator divides time up into shifts for a Schedule.
+type ShiftGenerator interface {
+	// Return consecutive shifts from the one containing start through
+	// the one containing until.
+	Shifts(start time.Time, until time.Time) []*Shift
+}
+
+// A Cadence is a rotation where a shift lasts a whole number of days and
+// every handoff happens at the same time of day. Handoffs fall on days
+// that are a multiple of Days away from a Weekday, counting from a fixed
+// date, so e.g. a biweekly rotation keeps the same weeks no matter when
+// the schedule is (re)built.
+type Cadence struct {
+	Days    int
+	Weekday time.Weekday
+	Hour    int
+	Minute  int
+	// Move handoffs which fall on a holiday to the next day which isn't
+	// one, see State.moveHandoffs
+	SkipHolidays bool
+}
+
+func WeeklyCadence(offset time.Weekday) Cadence {
+	return Cadence{Days: 7, Weekday: offset}
+}
+
+func (c Cadence) Shifts(start time.Time, until time.Time) []*Shift {
+	cur := c.lastHandoff(start)
+	shifts := []*Shift{}
+	for !cur.After(until) {
+		next := time.Date(cur.Year(), cur.Month(), cur.Day()+c.Days, c.Hour, c.Minute, 0, 0, cur.Location())
+		ashift, err := NewShift(cur, next)
+		if err != nil {
+			panic(err)
+		}
+		shifts = append(shifts, ashift)
+		cur = next
+	}
+	return shifts
+}
+
+// lastHandoff returns the handoff at or before t.
+func (c Cadence) lastHandoff(t time.Time) time.Time {
+	anchor := dayNumber(firstWeekday(c.Weekday))
+	for i := 0; ; i++ {
+		day := time.Date(t.Year(), t.Month(), t.Day()-i, c.Hour, c.Minute, 0, 0, t.Location())
+		if day.After(t) {
+			continue
+		}
+		if mod(dayNumber(day)-anchor, c.Days) == 0 {
+			return day
+		}
+	}
+}
+
+func (c Cadence) String() string {
+	str := c.period()
+	if c.SkipHolidays {
+		str += ", but not on holidays"
+	}
+	return str
+}
+
+func (c Cadence) period() string {
+	at := fmt.Sprintf("%02d:%02d", c.Hour, c.Minute)
+	switch {
+	case c.Days == 1:
+		return "every day at " + at
+	case c.Days == 7:
+		return fmt.Sprintf("every %v at %v", c.Weekday, at)
+	case c.Days%7 == 0:
+		return fmt.Sprintf("every %v weeks on %v at %v", c.Days/7, c.Weekday, at)
+	default:
+		return fmt.Sprintf("every %v days at %v, starting on a %v", c.Days, at, c.Weekday)
+	}
+}
+
+// ParseCadence understands a period (daily, weekly, biweekly, or a
+// number of days or weeks like 3d or 4w) optionally followed by the
+// weekday and time of day to hand off on, e.g. "biweekly wed 10:00",
+// and "skip-holidays" to move handoffs off holidays. Handoffs are on
+// weekday at midnight unless told otherwise.
+func ParseCadence(args []string, weekday time.Weekday) (Cadence, error) {
+	if len(args) == 0 {
+		return Cadence{}, errors.New("cadence <daily|weekly|biweekly|<n>d|<n>w> [weekday] [HH:MM] [skip-holidays]")
+	}
+	c := Cadence{Weekday: weekday}
+	period := strings.ToLower(args[0])
+	switch {
+	case period == "daily":
+		c.Days = 1
+	case period == "weekly":
+		c.Days = 7
+	case period == "biweekly" || period == "fortnightly":
+		c.Days = 14
+	case strings.HasSuffix(period, "d") || strings.HasSuffix(period, "w"):
+		n, err := strconv.Atoi(period[:len(period)-1])
+		if err != nil || n < 1 {
+			return c, fmt.Errorf("I don't understand the period %v, try daily, weekly, biweekly, 3d or 4w", args[0])
+		}
+		c.Days = n
+		if strings.HasSuffix(period, "w") {
+			c.Days = n * 7
+		}
+		if n > MAX_CADENCE_DAYS || c.Days > MAX_CADENCE_DAYS {
+			return c, fmt.Errorf("Shifts can be at most %v days long, %v is too long", MAX_CADENCE_DAYS, args[0])
+		}
+	default:
+		return c, fmt.Errorf("I don't understand the period %v, try daily, weekly, biweekly, 3d or 4w", args[0])
+	}
+	for _, arg := range args[1:] {
+		if strings.ToLower(arg) == "skip-holidays" {
+			c.SkipHolidays = true
+		} else if weekday, ok := parseWeekday(arg); ok {
+			c.Weekday = weekday
+		} else if hour, minute, ok := parseClock(arg); ok {
+			c.Hour, c.Minute = hour, minute
+		} else {
+			return c, fmt.Errorf("I don't understand %v, it should be a weekday, a time like 10:00 or skip-holidays", arg)
+		}
+	}
+	return c, nil
+}
+
+// parseWeekday understands full and abbreviated day names.
+func parseWeekday(s string) (time.Weekday, bool) {
+	s = strings.ToLower(s)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if s == name || (len(s) >= 3 && strings.HasPrefix(name, s)) {
+			return d, true
+		}
+	}
+	return time.Sunday, false
+}
+
+// parseClock understands a time of day as HH:MM or just HH.
+func parseClock(s string) (hour int, minute int, ok bool) {
+	parts := strings.SplitN(s, ":", 2)
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, 0, false
+	}
+	if len(parts) == 2 {
+		minute, err = strconv.Atoi(parts[1])
+		if err != nil || len(parts[1]) != 2 || minute < 0 || minute > 59 {
+			return 0, 0, false
+		}
+	}
+	return hour, minute, true
+}
+
+// dayNumber counts calendar days since the epoch, ignoring time zones.
+func dayNumber(t time.Time) int {
+	return int(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / (60 * 60 * 24))
+}
+
+// firstWeekday returns the first day in 1970 which is a weekday.
+func firstWeekday(weekday time.Weekday) time.Time {
+	day := time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for day.Weekday() != weekday {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day
+}
+
+// mod is % but always non-negative.
+func mod(a int, b int) int {
+	return ((a % b) + b) % b
+}
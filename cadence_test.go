@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCadenceShifts(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, time.October, 11, 22, 3, 0, 0, loc)
+	until := time.Date(2015, time.November, 5, 14, 1, 0, 0, loc)
+
+	c := Cadence{Days: 14, Weekday: time.Wednesday, Hour: 10}
+	shifts := c.Shifts(start, until)
+	if len(shifts) != 3 {
+		t.Fatalf("Wrong number of shifts: %v", shifts)
+	}
+	if !shifts[0].Contains(start) || !shifts[2].Contains(until) {
+		t.Fatalf("Shifts should cover start through until: %v", shifts)
+	}
+	for _, s := range shifts {
+		if s.Start().Weekday() != time.Wednesday || s.Start().Hour() != 10 || s.End().Sub(s.Start()) < time.Hour*24*13 {
+			t.Fatalf("Shift should be two weeks starting Wednesday at 10:00: %v", s)
+		}
+	}
+
+	// building a week later keeps the same handoffs
+	later := c.Shifts(start.AddDate(0, 0, 7), until)
+	if !later[0].Equal(shifts[1]) {
+		t.Fatalf("Handoffs moved when starting a week later: %v vs %v", later[0], shifts[1])
+	}
+
+	// handoffs stay at 10:00 across the DST change on Nov 1
+	c = Cadence{Days: 1, Hour: 10}
+	shifts = c.Shifts(start, until)
+	if len(shifts) != 26 {
+		t.Fatalf("Expected 26 daily shifts, got %v", len(shifts))
+	}
+	for _, s := range shifts {
+		if s.Start().Hour() != 10 || s.End().Hour() != 10 {
+			t.Fatalf("Handoff should be at 10:00: %v", s)
+		}
+	}
+}
+
+func TestParseCadence(t *testing.T) {
+	c, err := ParseCadence([]string{"biweekly", "wed", "10:00"}, time.Monday)
+	if err != nil || c != (Cadence{Days: 14, Weekday: time.Wednesday, Hour: 10}) {
+		t.Fatalf("Unexpected cadence: %v, err: %v", c, err)
+	}
+	c, err = ParseCadence([]string{"3d", "9:30"}, time.Monday)
+	if err != nil || c != (Cadence{Days: 3, Weekday: time.Monday, Hour: 9, Minute: 30}) {
+		t.Fatalf("Unexpected cadence: %v, err: %v", c, err)
+	}
+	c, err = ParseCadence([]string{"2w", "Friday"}, time.Monday)
+	if err != nil || c != (Cadence{Days: 14, Weekday: time.Friday}) {
+		t.Fatalf("Unexpected cadence: %v, err: %v", c, err)
+	}
+	c, err = ParseCadence([]string{"52w"}, time.Monday)
+	if err != nil || c.Days != 364 {
+		t.Fatalf("Unexpected cadence: %v, err: %v", c, err)
+	}
+	c, err = ParseCadence([]string{"weekly", "mon", "skip-holidays"}, time.Wednesday)
+	if err != nil || c != (Cadence{Days: 7, Weekday: time.Monday, SkipHolidays: true}) {
+		t.Fatalf("Unexpected cadence: %v, err: %v", c, err)
+	}
+	for _, bad := range [][]string{{}, {"monthly"}, {"0d"}, {"weekly", "10:5"}, {"daily", "blah"}, {"366d"}, {"53w"}, {"99999999d"}} {
+		_, err = ParseCadence(bad, time.Monday)
+		if err == nil {
+			t.Fatalf("%v shouldn't parse", bad)
+		}
+	}
+}
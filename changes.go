@@ -0,0 +1,50 @@
+package main
+
+// A changeSet is what's changed in a state since it was last saved.
+// Commands and the engine mark whatever they change as they change it, so
+// that saving only has to write those records, and so that a command
+// which didn't mark anything is known not to have changed anything.
+type changeSet struct {
+	// People by name, including ones who have been removed
+	people map[string]bool
+	// Rotations by name, including their schedules, and ones which have
+	// been removed
+	rotations map[string]bool
+	// The default rotation, history, holidays or sent reminders
+	other bool
+	// How many times anything has been marked, so a caller can tell
+	// whether anything was marked while it wasn't looking
+	marked int
+}
+
+// personChanged marks the person called name as needing to be saved.
+func (s *State) personChanged(name string) {
+	if s.changes.people == nil {
+		s.changes.people = make(map[string]bool)
+	}
+	s.changes.people[name] = true
+	s.changes.marked += 1
+}
+
+// rotationChanged marks the rotation called name as needing to be saved.
+func (s *State) rotationChanged(name string) {
+	if s.changes.rotations == nil {
+		s.changes.rotations = make(map[string]bool)
+	}
+	s.changes.rotations[name] = true
+	s.changes.marked += 1
+}
+
+// otherChanged marks everything which isn't a person or a rotation as
+// needing to be saved.
+func (s *State) otherChanged() {
+	s.changes.other = true
+	s.changes.marked += 1
+}
+
+// saved forgets what's changed, once it's all been saved.
+func (s *State) saved() {
+	s.changes.people = nil
+	s.changes.rotations = nil
+	s.changes.other = false
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// digest is a snapshot of everything in s that gets saved. JSON is used
+// rather than gob because it writes maps in a consistent order.
+func (s *State) digest() []byte {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// Every command which changes the state should mark what it changed, or
+// the change wouldn't be saved to a database.
+func TestChanges(t *testing.T) {
+	loc := inChicago(t)
+	at := time.Date(2015, time.October, 11, 22, 0, 0, 0, loc)
+	store, err := OpenBoltStore(filepath.Join(t.TempDir(), "sked.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	s := NewState(time.Wednesday)
+	s.SetStore(store)
+	if err := s.Persist(); err != nil {
+		t.Fatalf("Couldn't persist: %v", err)
+	}
+	check := func(what string) {
+		loaded := NewState(time.Wednesday)
+		loaded.SetStore(store)
+		if err := loaded.Populate(); err != nil {
+			t.Fatalf("Couldn't populate after %v: %v", what, err)
+		}
+		for _, p := range s.People {
+			if len(p.Unavailability) == 0 {
+				// which loads as nil
+				p.Unavailability = nil
+			}
+		}
+		if !bytes.Equal(s.digest(), loaded.digest()) {
+			t.Fatalf("%v wasn't all saved:\n%s\n%s", what, s.digest(), loaded.digest())
+		}
+	}
+
+	commandMap := newCommandMap()
+	for _, c := range []struct {
+		rotation string
+		words    string
+		changes  bool
+	}{
+		{"", "add joe", true},
+		{"", "add bob 1", true},
+		{"", "add sue 2", true},
+		{"", "list", false},
+		{"", "unavail joe 20151020", true},
+		{"", "unavail joe every friday", true},
+		{"", "unavail list joe", false},
+		{"", "unavail remove joe 1", true},
+		{"", "prefer bob not 20151021", true},
+		{"", "prefer list bob", false},
+		{"", "prefer remove bob 1", true},
+		{"", "tz joe Europe/London", true},
+		{"", "tz joe", false},
+		{"", "contact bob <@U0BOB>", true},
+		{"", "contact joe <@U0JOE>", true},
+		{"", "cadence daily", true},
+		{"", "rest 1", true},
+		{"", "strategy round-robin", true},
+		{"", "solver on 10ms", true},
+		{"", "solver off", true},
+		{"", "weights weekend 2", true},
+		{"", "holiday add 20151026 Some holiday", true},
+		{"", "holiday add 20151027", true},
+		{"", "holiday remove 20151027", true},
+		{"", "build", true},
+		{"", "who", false},
+		{"", "schedule", false},
+		{"", "cover sue 20151014 to 20151015", true},
+		{"", "edit joe 20151016 to 20151017", true},
+		{"", "remind 24h", true},
+		{"", "start <#C123>", true},
+		{"", "rotation add ops", true},
+		{"ops", "add joe", true},
+		{"", "rotation default ops", true},
+		{"", "rotation remove ops", true},
+		{"", "rotation default support", true},
+		{"", "remove sue", true},
+		{"", "history", false},
+	} {
+		words := strings.Fields(c.words)
+		act := commandMap[words[0]]
+		cc := command{action: words[0], args: words[1:], at: at, rotation: c.rotation}
+		msg, changed, err := perform(act, cc, s)
+		if err != nil {
+			t.Fatalf("Couldn't persist after %v: %v", c.words, err)
+		}
+		if changed != c.changes {
+			t.Fatalf("%v should have changed the state: %v, got: %v", c.words, c.changes, msg)
+		}
+		check(c.words)
+	}
+
+	// the engine changes the state as time passes too
+	notifier := &fakeNotifier{state: s}
+	e := NewEngine(s, &fakeClock{at.AddDate(0, 0, 13)}, notifier)
+	e.Tick()
+	if len(s.History) == 0 || len(notifier.dms) == 0 {
+		t.Fatalf("The engine should have committed shifts and sent a reminder: %v, %v", s.History, notifier.dms)
+	}
+	check("a tick")
+}
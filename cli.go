@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// A local runs commands from a terminal instead of Slack, against the same
+// state and command log, for "sked cli" and "sked repl".
+type local struct {
+	state      *State
+	commandMap map[string]action
+	audit      *AuditLog
+	// Slack ID the commands are run as, for their time zone and the audit
+	// log
+	user string
+}
+
+// openLocal parses the flags for the named subcommand and loads the state.
+// It returns the local and the arguments left after the flags.
+func openLocal(name string, usage string, args []string) (*local, []string) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	replay := flags.Bool("replay", false, "rebuild the state by replaying the command log instead of loading the state snapshot")
+	db := flags.String("db", "", "keep the state in a bbolt database at this path instead of "+DEFAULT_STORAGE_ID)
+	filename := flags.String("log", "sked-log.txt", "the command log")
+	user := flags.String("user", "", "the Slack ID to run commands as, for their time zone")
+	flags.StringVar(&holidayDir, "holidays", "", "the directory holiday import reads files from, import is turned off if empty")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sked %v [-replay] [-db path] [-log file] [-user id] [-holidays dir] %v\n", name, usage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	l := &local{commandMap: newCommandMap(), user: *user}
+	l.state = loadState(*filename, *db, *replay, l.commandMap)
+	auditLog, err := OpenAuditLog(*filename)
+	if err != nil {
+		log.Fatalf("Could not open file: %v, error: %v", *filename, err)
+	}
+	l.audit = auditLog
+	l.state.audit = auditLog
+	return l, flags.Args()
+}
+
+func (l *local) Close() {
+	l.audit.Close()
+	l.state.store().Close()
+}
+
+// run runs the command in words and returns what sked said, without the
+// formatting meant for Slack.
+func (l *local) run(words []string) (string, error) {
+	msg, err := runCommand(words, command{user: l.user, at: time.Now()}, l.commandMap, l.state, l.audit)
+	return strings.TrimSpace(strings.Replace(msg, "```", "\n", -1)), err
+}
+
+// cliMain runs a single command, for "sked cli".
+func cliMain(args []string) {
+	l, words := openLocal("cli", "[rotation] <command> [args...]", args)
+	defer l.Close()
+	msg, err := l.run(words)
+	fmt.Println(msg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not persist the state, error: %v\n", err)
+		l.Close()
+		os.Exit(1)
+	}
+}
+
+// replMain reads commands from stdin until it ends or says exit, for
+// "sked repl".
+func replMain(args []string) {
+	l, _ := openLocal("repl", "", args)
+	defer l.Close()
+	repl(l, os.Stdin, os.Stdout)
+}
+
+func repl(l *local, in io.Reader, out io.Writer) {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "sked> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
+		if words[0] == "exit" || words[0] == "quit" {
+			return
+		}
+		msg, err := l.run(words)
+		fmt.Fprintln(out, msg)
+		if err != nil {
+			fmt.Fprintf(out, "Could not persist the state, error: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCLI(t *testing.T) {
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	l, words := openLocal("cli", "", []string{"-log", "log.txt", "add", "joe"})
+	if strings.Join(words, " ") != "add joe" {
+		t.Fatalf("Unexpected command: %v", words)
+	}
+	if msg, err := l.run(words); err != nil || msg != "joe add with ordering 0" {
+		t.Fatalf("Unexpected response to add: %v, err: %v", msg, err)
+	}
+	l.Close()
+
+	// a second run sees what the first did
+	l, _ = openLocal("repl", "", []string{"-log", "log.txt"})
+	defer l.Close()
+	out := &bytes.Buffer{}
+	repl(l, strings.NewReader("add bob\n\nsupport build\nhelp add\nnope\nexit\nlist\n"), out)
+	responses := strings.Split(out.String(), "sked> ")
+	if len(responses) != 7 {
+		t.Fatalf("Expected a prompt for each line up to exit, got:\n%v", out)
+	}
+	if responses[1] != "bob add with ordering 0\n" {
+		t.Fatalf("Unexpected response to add: %q", responses[1])
+	}
+	if !strings.Contains(responses[3], "joe from") || !strings.Contains(responses[3], "bob from") || strings.Contains(responses[3], "```") {
+		t.Fatalf("Unexpected response to build: %q", responses[3])
+	}
+	if !strings.HasPrefix(responses[4], "add: Add a new person") {
+		t.Fatalf("Unexpected response to help: %q", responses[4])
+	}
+	if responses[5] != "sorry, that does not compute\n" {
+		t.Fatalf("Unexpected response to nope: %q", responses[5])
+	}
+	if entries, _ := l.audit.Recent(10); len(entries) != 3 || entries[2].Action != "build" || entries[2].Rotation != DEFAULT_ROTATION {
+		t.Fatalf("The commands should have been audited: %v", entries)
+	}
+}
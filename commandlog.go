@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// The command log is the audit log - see AuditEntry. Older logs have a
+// line per command with just the time it was issued and the command as it
+// was typed (minus the mention of sked), separated by a tab, or just the
+// command.
+
+// parseLogEntry turns a line of the command log into an AuditEntry. Lines
+// in the older formats are assumed to have changed the state, and have a
+// zero Time if it wasn't logged.
+func parseLogEntry(line string) AuditEntry {
+	var entry AuditEntry
+	if strings.HasPrefix(line, "{") && json.Unmarshal([]byte(line), &entry) == nil {
+		return entry
+	}
+	parts := strings.SplitN(line, "\t", 2)
+	if len(parts) == 2 {
+		at, err := time.Parse(time.RFC3339Nano, parts[0])
+		if err == nil {
+			entry.Time = at
+			line = parts[1]
+		}
+	}
+	fields := strings.Fields(line)
+	if len(fields) > 0 {
+		entry.Action = fields[0]
+		entry.Args = fields[1:]
+	}
+	entry.Changed = true
+	return entry
+}
+
+// Replay re-executes every command in the log which changed the state
+// against s, as of the time each was originally issued, and returns the
+// number of commands run. Commands that aren't in commandMap are skipped.
+func Replay(r io.Reader, commandMap map[string]action, s *State) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	n := 0
+	for scanner.Scan() {
+		entry := parseLogEntry(scanner.Text())
+		if entry.Action == "" || !entry.Changed {
+			continue
+		}
+		act, ok := commandMap[entry.Action]
+		if !ok {
+			log.Printf("Skipping unknown command while replaying: %v", entry.Action)
+			continue
+		}
+		act.function(command{
+			action:   entry.Action,
+			args:     entry.Args,
+			channel:  entry.Channel,
+			user:     entry.User,
+			at:       entry.Time,
+			rotation: entry.Rotation,
+		}, s)
+		n += 1
+	}
+	return n, scanner.Err()
+}
+
+// replayFile rebuilds a fresh State from the command log in filename.
+func replayFile(filename string, commandMap map[string]action) (*State, error) {
+	s := NewState(time.Wednesday)
+	f, err := os.Open(filename)
+	if err != nil {
+		return s, err
+	}
+	defer f.Close()
+	n, err := Replay(f, commandMap, s)
+	log.Printf("Replayed %v commands from %v", n, filename)
+	return s, err
+}
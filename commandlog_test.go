@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLogEntry(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	at := time.Date(2015, time.October, 11, 22, 3, 0, 0, loc)
+
+	line, _ := json.Marshal(AuditEntry{Time: at, User: "U123", Action: "add", Args: []string{"joe", "2"}, Changed: true})
+	entry := parseLogEntry(string(line))
+	if !entry.Time.Equal(at) || entry.User != "U123" || entry.Action != "add" || len(entry.Args) != 2 || !entry.Changed {
+		t.Fatalf("Log entry didn't round trip: %v", entry)
+	}
+
+	// entries from before the log was JSON
+	entry = parseLogEntry(at.Format(time.RFC3339Nano) + "\tadd joe 2")
+	if !entry.Time.Equal(at) || entry.Action != "add" || len(entry.Args) != 2 || !entry.Changed {
+		t.Fatalf("Couldn't parse a timestamped log entry: %v", entry)
+	}
+	entry = parseLogEntry("add joe 2")
+	if !entry.Time.IsZero() || entry.Action != "add" || len(entry.Args) != 2 || !entry.Changed {
+		t.Fatalf("Couldn't parse an old log entry: %v", entry)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	loc := inChicago(t)
+	at := time.Date(2015, time.October, 11, 22, 3, 0, 0, loc)
+	entries := []AuditEntry{
+		{Time: at, Action: "add", Args: []string{"joe"}, Changed: true},
+		{Time: at, Action: "add", Args: []string{"bob", "1"}, Changed: true},
+		{Time: at, Action: "bogus", Args: []string{"command"}, Changed: true},
+		{Time: at, Action: "add", Args: []string{"sue"}, Changed: false},
+		{Time: at, Action: "unavail", Args: []string{"joe", "20151015"}, Changed: true},
+		{Time: at.Add(time.Minute), Action: "build", Args: []string{}, Changed: true},
+	}
+	lines := make([]string, len(entries))
+	for i, e := range entries {
+		line, _ := json.Marshal(e)
+		lines[i] = string(line)
+	}
+	// an entry from before the log was JSON
+	lines = append(lines, "add ann", "")
+
+	s := NewState(time.Wednesday)
+	n, err := Replay(strings.NewReader(strings.Join(lines, "\n")), newCommandMap(), s)
+	if err != nil {
+		t.Fatalf("Unexpected error replaying: %v", err)
+	}
+	if n != 5 {
+		t.Fatalf("Expected to replay 5 commands, not %v", n)
+	}
+	if len(s.People) != 3 || s.Default().Members["bob"].OrderNum != 1 || s.People["sue"] != nil {
+		t.Fatalf("People weren't added properly: %v", s.People)
+	}
+
+	// the schedule is built as of when the command was originally issued
+	expected := NewState(time.Wednesday)
+	expected.AddPerson("joe", 0)
+	expected.AddPerson("bob", 1)
+	expected.People["joe"].AddUnavailable(&Interval{time.Date(2015, time.October, 15, 0, 0, 0, 0, time.Local),
+		time.Date(2015, time.October, 16, 0, 0, 0, 0, time.Local)})
+	sched := expected.BuildSchedule(at.Add(time.Minute), at.Add(time.Minute).Add(time.Hour*24*7*10))
+	if s.Default().Schedule.String() != sched.String() {
+		t.Fatalf("Replayed schedule:\n%v\nshould be:\n%v", s.Default().Schedule, sched)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The ways a date can be written, for help and error messages
+const DATE_FORMATS = "2026-11-03, 2026-11-03 14:00, 2026-11-03T14:00-05:00, [YYYY]MMDD[HH], today, tomorrow, friday, next friday, in 3 days or tomorrow at 2pm"
+
+// ISO 8601 layouts, the ones with a time of day first
+var isoLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseDate reads a date from the front of args, relative to now and in
+// now's time zone unless it says otherwise. It returns the date, whether
+// it had a time of day (otherwise it's at midnight), and how many of args
+// it used. A weekday means the next one on or after today, "next friday"
+// the first friday after today.
+func parseDate(args []string, now time.Time) (date time.Time, hasClock bool, n int, err error) {
+	if len(args) == 0 {
+		return time.Time{}, false, 0, fmt.Errorf("I need a date like %v", DATE_FORMATS)
+	}
+	today := atMidnight(now)
+	word := strings.ToLower(args[0])
+	n = 1
+	switch {
+	case word == "now":
+		return now, true, 1, nil
+	case word == "today":
+		date = today
+	case word == "tomorrow":
+		date = today.AddDate(0, 0, 1)
+	case word == "yesterday":
+		date = today.AddDate(0, 0, -1)
+	case word == "in" && len(args) >= 3:
+		num, err := strconv.Atoi(args[1])
+		if err != nil || num < 0 {
+			return time.Time{}, false, 0, dateError(args[:3])
+		}
+		n = 3
+		switch strings.TrimSuffix(strings.ToLower(args[2]), "s") {
+		case "minute", "min":
+			return now.Add(time.Duration(num) * time.Minute), true, n, nil
+		case "hour":
+			return now.Add(time.Duration(num) * time.Hour), true, n, nil
+		case "day":
+			date = today.AddDate(0, 0, num)
+		case "week":
+			date = today.AddDate(0, 0, 7*num)
+		default:
+			return time.Time{}, false, 0, dateError(args[:3])
+		}
+	case (word == "next" || word == "this") && len(args) >= 2:
+		weekday, ok := parseWeekday(args[1])
+		if !ok {
+			return time.Time{}, false, 0, dateError(args[:2])
+		}
+		date = upcoming(today, weekday, word == "next")
+		n = 2
+	default:
+		if weekday, ok := parseWeekday(word); ok {
+			date = upcoming(today, weekday, false)
+			break
+		}
+		for i, layout := range isoLayouts {
+			date, err = time.ParseInLocation(layout, args[0], now.Location())
+			if err == nil {
+				if i < len(isoLayouts)-1 {
+					return date.In(now.Location()), true, 1, nil
+				}
+				break
+			}
+		}
+		if err != nil {
+			date, err = getDate(args[0], now)
+			if err != nil {
+				return time.Time{}, false, 0, dateError(args[:1])
+			}
+			return date, len(args[0]) == 6 || len(args[0]) == 10, 1, nil
+		}
+	}
+	// a day can be followed by a time of day, e.g. tomorrow at 2pm
+	rest := args[n:]
+	if len(rest) >= 2 && strings.ToLower(rest[0]) == "at" {
+		if hour, minute, ok := parseTimeOfDay(rest[1]); ok {
+			return withClock(date, hour, minute), true, n + 2, nil
+		}
+		return time.Time{}, false, 0, dateError(args[:n+2])
+	} else if len(rest) >= 1 {
+		if hour, minute, ok := parseTimeOfDay(rest[0]); ok {
+			return withClock(date, hour, minute), true, n + 1, nil
+		}
+	}
+	return date, false, n, nil
+}
+
+// parseSpan reads "<date> [to <date>]" from args, which must be all of
+// them. A single date without a time of day means that whole day,
+// otherwise the span lasts for length.
+func parseSpan(args []string, now time.Time, length time.Duration) (*Interval, error) {
+	start, hasClock, n, err := parseDate(args, now)
+	if err != nil {
+		return nil, err
+	}
+	rest := args[n:]
+	var end time.Time
+	if len(rest) == 0 {
+		if hasClock {
+			end = start.Add(length)
+		} else {
+			end = start.AddDate(0, 0, 1)
+		}
+	} else if rest[0] == "to" || rest[0] == "until" {
+		var m int
+		end, _, m, err = parseDate(rest[1:], now)
+		if err != nil {
+			return nil, err
+		}
+		if m != len(rest)-1 {
+			return nil, dateError(rest[1:])
+		}
+	} else {
+		return nil, dateError(args)
+	}
+	interval, err := NewInterval(start, end)
+	if err != nil {
+		return nil, fmt.Errorf("Your end time:%v is before your start time:%v",
+			end.Format(TIME_FORMAT), start.Format(TIME_FORMAT))
+	}
+	return interval, nil
+}
+
+func dateError(args []string) error {
+	return fmt.Errorf("I had trouble understanding the date %v, try something like %v",
+		strings.Join(args, " "), DATE_FORMATS)
+}
+
+// Given a string representing a date as [YYYY]MMDD[HH], get the Time
+// object. The year defaults to now's.
+func getDate(dateStr string, now time.Time) (time.Time, error) {
+	loc := now.Location()
+	if _, err := strconv.Atoi(dateStr); err != nil {
+		return time.Time{}, errors.New("Dates should be all digits - [YYYY]MMDD[HH]")
+	}
+	switch len(dateStr) {
+	case 4:
+		return time.ParseInLocation("20060102", fmt.Sprintf("%v%v", now.Year(), dateStr), loc)
+	case 6:
+		return time.ParseInLocation("2006010215", fmt.Sprintf("%v%v", now.Year(), dateStr), loc)
+	case 8:
+		return time.ParseInLocation("20060102", dateStr, loc)
+	case 10:
+		return time.ParseInLocation("2006010215", dateStr, loc)
+	}
+	return time.Time{}, errors.New("Dates should be [YYYY]MMDD[HH]")
+}
+
+// parseTimeOfDay understands 14:00, 2pm, 2:30pm, noon and midnight. A bare
+// hour isn't allowed, since it could be the start of another argument.
+func parseTimeOfDay(s string) (hour int, minute int, ok bool) {
+	s = strings.ToLower(s)
+	switch s {
+	case "noon":
+		return 12, 0, true
+	case "midnight":
+		return 0, 0, true
+	}
+	pm := strings.HasSuffix(s, "pm")
+	if pm || strings.HasSuffix(s, "am") {
+		hour, minute, ok = parseClock(s[:len(s)-2])
+		if !ok || hour < 1 || hour > 12 {
+			return 0, 0, false
+		}
+		hour = hour % 12
+		if pm {
+			hour += 12
+		}
+		return hour, minute, true
+	}
+	if !strings.Contains(s, ":") {
+		return 0, 0, false
+	}
+	return parseClock(s)
+}
+
+// upcoming returns the first weekday on or after today, or strictly after
+// today if after is set.
+func upcoming(today time.Time, weekday time.Weekday, after bool) time.Time {
+	days := mod(int(weekday)-int(today.Weekday()), 7)
+	if days == 0 && after {
+		days = 7
+	}
+	return today.AddDate(0, 0, days)
+}
+
+func withClock(day time.Time, hour int, minute int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location())
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	// a Wednesday
+	now := time.Date(2026, time.October, 14, 15, 30, 0, 0, loc)
+
+	tests := []struct {
+		args     string
+		expected time.Time
+		hasClock bool
+		n        int
+	}{
+		{"2026-11-03", time.Date(2026, time.November, 3, 0, 0, 0, 0, loc), false, 1},
+		{"2026-11-03 14:00", time.Date(2026, time.November, 3, 14, 0, 0, 0, loc), true, 2},
+		{"2026-11-03T14:00", time.Date(2026, time.November, 3, 14, 0, 0, 0, loc), true, 1},
+		{"2026-11-03T14:00:00Z", time.Date(2026, time.November, 3, 8, 0, 0, 0, loc), true, 1},
+		{"1103", time.Date(2026, time.November, 3, 0, 0, 0, 0, loc), false, 1},
+		{"2015110314", time.Date(2015, time.November, 3, 14, 0, 0, 0, loc), true, 1},
+		{"now", now, true, 1},
+		{"today", time.Date(2026, time.October, 14, 0, 0, 0, 0, loc), false, 1},
+		{"tomorrow at 2pm", time.Date(2026, time.October, 15, 14, 0, 0, 0, loc), true, 3},
+		{"friday to monday", time.Date(2026, time.October, 16, 0, 0, 0, 0, loc), false, 1},
+		{"wed", time.Date(2026, time.October, 14, 0, 0, 0, 0, loc), false, 1},
+		{"next wednesday 9:30am", time.Date(2026, time.October, 21, 9, 30, 0, 0, loc), true, 3},
+		{"in 3 days", time.Date(2026, time.October, 17, 0, 0, 0, 0, loc), false, 3},
+		{"in 2 hours", time.Date(2026, time.October, 14, 17, 30, 0, 0, loc), true, 3},
+		{"in 1 week noon", time.Date(2026, time.October, 21, 12, 0, 0, 0, loc), true, 4},
+	}
+	for _, test := range tests {
+		date, hasClock, n, err := parseDate(strings.Fields(test.args), now)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing %v: %v", test.args, err)
+		}
+		if !date.Equal(test.expected) || hasClock != test.hasClock || n != test.n {
+			t.Fatalf("%v should be %v, %v, %v, not %v, %v, %v", test.args,
+				test.expected, test.hasClock, test.n, date, hasClock, n)
+		}
+	}
+
+	for _, bad := range []string{"blah", "13", "1340", "in 3 fortnights", "next blah", "tomorrow at 25:00", "2026-13-01"} {
+		_, _, _, err := parseDate(strings.Fields(bad), now)
+		if err == nil || !strings.Contains(err.Error(), DATE_FORMATS) {
+			t.Fatalf("Expected a helpful error parsing %v, got: %v", bad, err)
+		}
+	}
+}
+
+func TestParseSpan(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	now := time.Date(2026, time.October, 14, 15, 30, 0, 0, loc)
+
+	when, err := parseSpan([]string{"friday"}, now, time.Hour)
+	if err != nil || !when.Equal(&Interval{time.Date(2026, time.October, 16, 0, 0, 0, 0, loc), time.Date(2026, time.October, 17, 0, 0, 0, 0, loc)}) {
+		t.Fatalf("friday should be all day, got: %v, %v", when, err)
+	}
+	when, err = parseSpan(strings.Fields("2026-11-03 14:00"), now, time.Hour)
+	if err != nil || !when.End().Equal(time.Date(2026, time.November, 3, 15, 0, 0, 0, loc)) {
+		t.Fatalf("A time should last an hour, got: %v, %v", when, err)
+	}
+	when, err = parseSpan(strings.Fields("tomorrow to next monday at 10:00"), now, time.Hour)
+	if err != nil || !when.End().Equal(time.Date(2026, time.October, 19, 10, 0, 0, 0, loc)) {
+		t.Fatalf("Unexpected span: %v, %v", when, err)
+	}
+	_, err = parseSpan(strings.Fields("tomorrow to today"), now, time.Hour)
+	if err == nil {
+		t.Fatalf("The end should be after the start")
+	}
+	_, err = parseSpan(strings.Fields("tomorrow blah"), now, time.Hour)
+	if err == nil {
+		t.Fatalf("Shouldn't ignore extra arguments")
+	}
+}
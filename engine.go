@@ -1,16 +1,234 @@
 package main
 
 import (
+	"fmt"
+	"log"
 	"time"
 )
 
-func runSchedule(skedState *State) {
-	// lastRun := time.Date(0, 1, 1, 0, 0, 0, 0, time.Local)
+// How often the engine wakes up to look at the schedule
+const TICK_INTERVAL = time.Second * 10
+
+// A Clock tells the engine what time it is. Tests substitute their own
+// so that handoffs can be checked without sleeping.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// A Notifier delivers the engine's announcements somewhere people will
+// see them (i.e. a Slack channel), and reminders to individual people.
+type Notifier interface {
+	Notify(channel string, text string) error
+	DirectMessage(user string, text string) error
+}
+
+// An Engine watches the schedule of every rotation and announces whenever
+// the person on shift changes. It also reminds people ahead of their
+// shifts.
+type Engine struct {
+	state    *State
+	clock    Clock
+	notifier Notifier
+	// The last shift announced in each rotation
+	lastShifts map[string]*Shift
+	stop       chan struct{}
+}
+
+func NewEngine(s *State, clock Clock, notifier Notifier) *Engine {
+	return &Engine{
+		state:      s,
+		clock:      clock,
+		notifier:   notifier,
+		lastShifts: make(map[string]*Shift),
+		stop:       make(chan struct{}),
+	}
+}
+
+// A message is something the engine has decided to send, which it sends
+// once it has let go of the state lock, so that nothing else waits on
+// Slack.
+type message struct {
+	send func() error
+	// What the message was, for the log if it can't be sent
+	what string
+	// Records that it was sent, with the state lock held, and returns
+	// whether that changed the state
+	sent func() bool
+}
+
+// Tick checks the schedule at the current time, announces a handoff if
+// the shift has changed since the last tick, commits finished shifts to
+// the history, sends any reminders which have come due, and forgets
+// anything which is over.
+func (e *Engine) Tick() {
+	e.state.Lock()
+	now := e.clock.Now()
+	changed := e.state.pruneReminders(now)
+	if e.state.pruneUnavailability(now) {
+		changed = true
+	}
+	messages := []message{}
+	for _, name := range e.state.RotationNames() {
+		r := e.state.Rotations[name]
+		if r.Schedule == nil {
+			continue
+		}
+		messages = append(messages, e.announce(r, now)...)
+		messages = append(messages, e.remind(r, now)...)
+	}
+	if e.state.CommitShifts(now) || changed {
+		e.persist()
+	}
+	e.state.Unlock()
+
+	sent := []message{}
+	for _, m := range messages {
+		if err := m.send(); err != nil {
+			log.Printf("Couldn't %v, err: %v", m.what, err)
+			continue
+		}
+		sent = append(sent, m)
+	}
+	if len(sent) == 0 {
+		return
+	}
+	e.state.Lock()
+	defer e.state.Unlock()
+	changed = false
+	for _, m := range sent {
+		if m.sent() {
+			changed = true
+		}
+	}
+	if changed {
+		e.persist()
+	}
+}
+
+// persist saves the state. The caller must hold the state lock.
+func (e *Engine) persist() {
+	err := e.state.Persist()
+	if err != nil {
+		log.Printf("Couldn't persist state from the engine, err: %v", err)
+	}
+}
+
+// announce returns the message telling the rotation's channel about the
+// shift at now if it is new. The caller must hold the state lock.
+func (e *Engine) announce(r *Rotation, now time.Time) []message {
+	if r.Channel == "" {
+		return nil
+	}
+	shift, err := r.Schedule.GetShift(now)
+	if err != nil {
+		// nothing scheduled right now, remember that so that the next
+		// shift to start gets announced
+		delete(e.lastShifts, r.Name)
+		return nil
+	}
+	if last, ok := e.lastShifts[r.Name]; ok && sameShift(last, shift) {
+		return nil
+	}
+	channel, name := r.Channel, r.Name
+	msg := fmt.Sprintf("%v is now on %v until %v",
+		shift.Worker().Identifier(), r.Name, shift.End().Format(TIME_FORMAT))
+	return []message{{
+		send: func() error { return e.notifier.Notify(channel, msg) },
+		what: fmt.Sprintf("announce handoff to %v", channel),
+		sent: func() bool {
+			e.lastShifts[name] = shift
+			return false
+		},
+	}}
+}
+
+// remind returns a direct message to the worker of each upcoming shift in
+// r once the shift is within one of the rotation's reminder lead times.
+// Each reminder is recorded in the state once it's sent so that it is only
+// sent once, even across restarts. If several lead times have passed at
+// once (e.g. sked was down) only one reminder is sent. The caller must
+// hold the state lock.
+func (e *Engine) remind(r *Rotation, now time.Time) []message {
+	s := e.state
+	messages := []message{}
+	for _, shift := range r.Schedule.ShiftsList {
+		if !shift.Start().After(now) {
+			continue
+		}
+		p, ok := s.People[shift.Worker().Identifier()]
+		if !ok || p.SlackUser() == "" {
+			continue
+		}
+		var due []time.Duration
+		unsent := false
+		for _, lead := range r.ReminderLeads {
+			if now.Before(shift.Start().Add(-lead)) {
+				continue
+			}
+			due = append(due, lead)
+			if !s.reminderSent(r, shift, lead) {
+				unsent = true
+			}
+		}
+		if !unsent {
+			continue
+		}
+		user, shift := p.SlackUser(), shift
+		msg := fmt.Sprintf("Reminder: you're on %v from %v to %v (starts in %v)", r.Name,
+			shift.Start().In(p.Location()).Format(TIME_FORMAT), shift.End().In(p.Location()).Format(TIME_FORMAT),
+			formatLead(shift.Start().Sub(now)))
+		messages = append(messages, message{
+			send: func() error { return e.notifier.DirectMessage(user, msg) },
+			what: fmt.Sprintf("remind %v about %v", p.Identifier(), shift),
+			sent: func() bool {
+				for _, lead := range due {
+					s.markReminderSent(r, shift, lead)
+				}
+				return true
+			},
+		})
+	}
+	return messages
+}
+
+// Run ticks every interval until Stop is called.
+func (e *Engine) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 	for {
-		skedState.Lock()
+		e.Tick()
+		select {
+		case <-ticker.C:
+		case <-e.stop:
+			return
+		}
+	}
+}
 
-		skedState.Unlock()
-		// lastRun := time.Now()
-		time.Sleep(time.Second * 10)
+func (e *Engine) Stop() {
+	close(e.stop)
+}
+
+// sameShift reports whether a and b cover the same time with the same
+// worker. Shifts are compared by value because rebuilding or reloading
+// the schedule creates new Shift objects for unchanged shifts.
+func sameShift(a *Shift, b *Shift) bool {
+	return a.Equal(b) && a.Worker().Identifier() == b.Worker().Identifier()
+}
+
+// runSchedule starts an engine for skedState if one isn't already running
+// and there is a way to send its announcements. The caller must hold the
+// state lock.
+func runSchedule(skedState *State) {
+	if skedState.engine != nil || skedState.notifier == nil {
+		return
 	}
+	skedState.engine = NewEngine(skedState, realClock{}, skedState.notifier)
+	go skedState.engine.Run(TICK_INTERVAL)
 }
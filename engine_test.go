@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+type fakeNotifier struct {
+	channels []string
+	messages []string
+	users    []string
+	dms      []string
+	// If set, whether its lock was held while sending anything
+	state  *State
+	locked bool
+}
+
+func (n *fakeNotifier) Notify(channel string, text string) error {
+	n.checkLock()
+	n.channels = append(n.channels, channel)
+	n.messages = append(n.messages, text)
+	return nil
+}
+
+func (n *fakeNotifier) DirectMessage(user string, text string) error {
+	n.checkLock()
+	n.users = append(n.users, user)
+	n.dms = append(n.dms, text)
+	return nil
+}
+
+func (n *fakeNotifier) checkLock() {
+	if n.state == nil {
+		return
+	}
+	if n.state.lock.TryLock() {
+		n.state.lock.Unlock()
+	} else {
+		n.locked = true
+	}
+}
+
+func TestEngineAnnouncesHandoff(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, time.October, 11, 22, 0, 0, 0, loc)
+	end := time.Date(2015, time.November, 18, 17, 0, 0, 0, loc)
+
+	s := NewState(time.Wednesday)
+	s.StorageID = filepath.Join(t.TempDir(), "skedState.json")
+	s.AddPerson("joe", 0)
+	s.AddPerson("bob", 0)
+	s.Default().Schedule = s.BuildSchedule(start, end)
+	s.Default().Channel = "C123"
+
+	clock := &fakeClock{start}
+	notifier := &fakeNotifier{}
+	e := NewEngine(s, clock, notifier)
+
+	e.Tick()
+	if len(notifier.messages) != 1 {
+		t.Fatalf("Expected the current shift to be announced, got: %v", notifier.messages)
+	}
+	if notifier.channels[0] != "C123" {
+		t.Fatalf("Announced in the wrong channel: %v", notifier.channels[0])
+	}
+	first, _ := s.Default().Schedule.GetShift(start)
+	if !strings.HasPrefix(notifier.messages[0], first.Worker().Identifier()+" is now on support until") {
+		t.Fatalf("Unexpected announcement: %v", notifier.messages[0])
+	}
+
+	// same shift - nothing new to say
+	clock.now = start.Add(time.Hour * 24)
+	e.Tick()
+	if len(notifier.messages) != 1 {
+		t.Fatalf("Should not announce again during the same shift, got: %v", notifier.messages)
+	}
+
+	// next shift
+	clock.now = first.End().Add(time.Minute)
+	e.Tick()
+	if len(notifier.messages) != 2 {
+		t.Fatalf("Expected a handoff announcement, got: %v", notifier.messages)
+	}
+	second, _ := s.Default().Schedule.GetShift(clock.now)
+	if !strings.HasPrefix(notifier.messages[1], second.Worker().Identifier()+" is now on support until") {
+		t.Fatalf("Unexpected announcement: %v", notifier.messages[1])
+	}
+}
+
+func TestEngineNoChannel(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, time.October, 11, 22, 0, 0, 0, loc)
+	end := time.Date(2015, time.November, 18, 17, 0, 0, 0, loc)
+
+	s := NewState(time.Wednesday)
+	s.AddPerson("joe", 0)
+	s.Default().Schedule = s.BuildSchedule(start, end)
+
+	notifier := &fakeNotifier{}
+	e := NewEngine(s, &fakeClock{start}, notifier)
+	e.Tick()
+	if len(notifier.messages) != 0 {
+		t.Fatalf("Should not announce without a channel, got: %v", notifier.messages)
+	}
+}
+
+func TestEngineReminders(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, time.October, 11, 22, 0, 0, 0, loc)
+	end := time.Date(2015, time.November, 18, 17, 0, 0, 0, loc)
+
+	s := NewState(time.Wednesday)
+	s.StorageID = filepath.Join(t.TempDir(), "skedState.json")
+	s.AddPerson("joe", 0)
+	s.AddPerson("<@U0BOB>", 0)
+	s.People["joe"].SlackID = "U0JOE"
+	s.Default().Schedule = s.BuildSchedule(start, end)
+	s.Default().ReminderLeads = []time.Duration{time.Hour * 24, time.Hour}
+
+	first, _ := s.Default().Schedule.GetShift(start)
+	second, _ := s.Default().Schedule.GetShift(first.End().Add(time.Minute))
+	expectedUser := s.People[second.Worker().Identifier()].SlackUser()
+
+	clock := &fakeClock{second.Start().Add(-time.Hour * 25)}
+	notifier := &fakeNotifier{state: s}
+	e := NewEngine(s, clock, notifier)
+	e.Tick()
+	if len(notifier.dms) != 0 {
+		t.Fatalf("Nothing should be due yet, got: %v", notifier.dms)
+	}
+
+	clock.now = second.Start().Add(-time.Hour * 23)
+	e.Tick()
+	if len(notifier.dms) != 1 || notifier.users[0] != expectedUser {
+		t.Fatalf("Expected a reminder for %v, got: %v %v", expectedUser, notifier.users, notifier.dms)
+	}
+	if notifier.locked {
+		t.Fatalf("Reminders shouldn't be sent with the state locked")
+	}
+
+	// a restarted engine shouldn't send it again
+	e = NewEngine(s, clock, notifier)
+	clock.now = clock.now.Add(time.Hour)
+	e.Tick()
+	if len(notifier.dms) != 1 {
+		t.Fatalf("Reminder was sent twice: %v", notifier.dms)
+	}
+
+	clock.now = second.Start().Add(-time.Minute * 30)
+	e.Tick()
+	if len(notifier.dms) != 2 {
+		t.Fatalf("Expected the 1h reminder, got: %v", notifier.dms)
+	}
+
+	// once the shift starts its reminders are forgotten
+	clock.now = second.Start().Add(time.Minute)
+	e.Tick()
+	for key := range s.SentReminders {
+		if strings.Contains(key, fmt.Sprintf("|%v|", second.Start().Unix())) {
+			t.Fatalf("Reminder %v should have been pruned", key)
+		}
+	}
+}
+
+func TestFormatLead(t *testing.T) {
+	expected := map[string]string{
+		"24h": "24h",
+		"1h":  "1h",
+		"30m": "30m",
+		"90m": "1h30m",
+		"2d":  "48h",
+	}
+	for in, out := range expected {
+		d, err := parseLead(in)
+		if err != nil {
+			t.Fatalf("Couldn't parse %v: %v", in, err)
+		}
+		if formatLead(d) != out {
+			t.Fatalf("%v should format as %v, not %v", in, out, formatLead(d))
+		}
+	}
+}
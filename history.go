@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A ShiftRecord is a shift which has been worked. Unlike the shifts in a
+// Schedule, records are kept after the schedule is rebuilt. Records are
+// only ever appended to State.History.
+type ShiftRecord struct {
+	StartTime time.Time
+	EndTime   time.Time
+	Worker    string
+	// How the shift was changed after the schedule was built, if at all
+	Change   string
+	Rotation string
+	// How much the shift counted for, see State.weigher
+	Weight float64
+}
+
+// weight is r.Weight, for records from before shifts were weighted too.
+func (r *ShiftRecord) weight() float64 {
+	if r.Weight == 0 {
+		return 1
+	}
+	return r.Weight
+}
+
+func (r *ShiftRecord) Start() time.Time {
+	return r.StartTime
+}
+
+func (r *ShiftRecord) End() time.Time {
+	return r.EndTime
+}
+
+func (r *ShiftRecord) String() string {
+	return r.Format(r.Start().Location())
+}
+
+// Format describes the record for people, with times in loc.
+func (r *ShiftRecord) Format(loc *time.Location) string {
+	str := fmt.Sprintf("%v from %v to %v", r.Worker,
+		r.Start().In(loc).Format(TIME_FORMAT), r.End().In(loc).Format(TIME_FORMAT))
+	if r.Change != UNCHANGED {
+		str += fmt.Sprintf(" (%v)", r.Change)
+	}
+	return str
+}
+
+// CommitShifts records every shift in each rotation's schedule which has
+// finished by now and hasn't been recorded yet, and adjusts the priorities
+// of the rotation's members the same way BuildSchedule does, so that the
+// next schedule built accounts for who actually worked. Returns whether
+// anything was committed.
+func (s *State) CommitShifts(now time.Time) bool {
+	committed := false
+	for _, name := range s.RotationNames() {
+		if s.commitRotation(s.Rotations[name], now) {
+			committed = true
+		}
+	}
+	return committed
+}
+
+func (s *State) commitRotation(r *Rotation, now time.Time) bool {
+	if r.Schedule == nil {
+		return false
+	}
+	committed := false
+	weigh := s.weigher(r)
+	for _, shift := range r.Schedule.ShiftsList {
+		if shift.End().After(now) || !shift.End().After(r.CommittedUntil) {
+			continue
+		}
+		start := shift.Start()
+		if start.Before(r.CommittedUntil) {
+			// only the part that hasn't been counted yet (i.e. the
+			// schedule was rebuilt part way through this shift)
+			start = r.CommittedUntil
+		}
+		r.CommittedUntil = shift.End()
+		committed = true
+
+		worker := shift.Worker().Identifier()
+		if worker == EMPTY_WORKER {
+			continue
+		}
+		record := &ShiftRecord{
+			StartTime: start,
+			EndTime:   shift.End(),
+			Worker:    worker,
+			Change:    shift.Change,
+			Rotation:  r.Name,
+		}
+		record.Weight = weigh(&Interval{start, shift.End()})
+		s.History = append(s.History, record)
+		if _, ok := r.Members[worker]; !ok {
+			// they've been removed since
+			continue
+		}
+		for _, m := range r.Members {
+			if m.Name != worker {
+				m.PriorityNum -= 1
+			} else {
+				m.PriorityNum += weightedPriority(len(r.Members), record.Weight)
+			}
+		}
+	}
+	if committed {
+		s.rotationChanged(r.Name)
+		s.otherChanged()
+	}
+	return committed
+}
+
+// WorkedBy returns the recorded shifts worked by the named person.
+func (s *State) WorkedBy(name string) []*ShiftRecord {
+	records := []*ShiftRecord{}
+	for _, r := range s.History {
+		if r.Worker == name {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// HistorySince returns the recorded shifts in the named rotation which
+// ended after since, worked by the named person, or by anyone if name is
+// "".
+func (s *State) HistorySince(rotation string, name string, since time.Time) []*ShiftRecord {
+	records := []*ShiftRecord{}
+	for _, r := range s.History {
+		if r.Rotation == rotation && (name == "" || r.Worker == name) && r.End().After(since) {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// summarizeHistory totals up the shifts and time worked by each person in
+// records, one line per person.
+func summarizeHistory(records []*ShiftRecord) string {
+	counts := make(map[string]int)
+	worked := make(map[string]time.Duration)
+	names := []string{}
+	for _, r := range records {
+		if _, ok := counts[r.Worker]; !ok {
+			names = append(names, r.Worker)
+		}
+		counts[r.Worker] += 1
+		worked[r.Worker] += r.End().Sub(r.Start())
+	}
+	sort.Strings(names)
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = fmt.Sprintf("%v: %v shifts, %v", name, counts[name], formatDays(worked[name]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatDays(d time.Duration) string {
+	days := d.Hours() / 24
+	if days == float64(int(days)) {
+		return fmt.Sprintf("%v days", int(days))
+	}
+	return fmt.Sprintf("%.1f days", days)
+}
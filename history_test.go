@@ -0,0 +1,136 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommitShifts(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, time.October, 11, 22, 0, 0, 0, loc)
+	end := time.Date(2015, time.November, 18, 17, 0, 0, 0, loc)
+
+	s := NewState(time.Wednesday)
+	s.AddPerson("joe", 0)
+	s.AddPerson("bob", 0)
+	s.AddPerson("sue", 0)
+	s.Default().Schedule = s.BuildSchedule(start, end)
+
+	if s.CommitShifts(start) {
+		t.Fatalf("Nothing should have finished yet")
+	}
+
+	first, _ := s.Default().Schedule.GetShift(start)
+	worker := first.Worker().Identifier()
+	if !s.CommitShifts(first.End().Add(time.Hour)) {
+		t.Fatalf("The first shift should have been committed")
+	}
+	if len(s.History) != 1 || s.History[0].Worker != worker {
+		t.Fatalf("History should just have %v's shift, but is %v", worker, s.History)
+	}
+	for name, m := range s.Default().Members {
+		if name == worker && m.PriorityNum != 3 {
+			t.Fatalf("%v worked, priority should be 3, not %v", name, m.PriorityNum)
+		} else if name != worker && m.PriorityNum != -1 {
+			t.Fatalf("%v didn't work, priority should be -1, not %v", name, m.PriorityNum)
+		}
+	}
+
+	// committing again doesn't count the shift twice
+	if s.CommitShifts(first.End().Add(time.Hour * 2)) {
+		t.Fatalf("The first shift was committed twice")
+	}
+
+	// a rebuilt schedule starts from the committed priorities, so someone
+	// else gets the next shift
+	s.Default().Schedule = s.BuildSchedule(first.End().Add(time.Hour), end)
+	next, _ := s.Default().Schedule.GetShift(first.End().Add(time.Hour))
+	if next.Worker().Identifier() == worker {
+		t.Fatalf("%v shouldn't work twice in a row", worker)
+	}
+	if len(s.WorkedBy(worker)) != 1 {
+		t.Fatalf("%v should have worked one shift, not %v", worker, s.WorkedBy(worker))
+	}
+}
+
+func TestRebuildKeepsCurrentShift(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, time.October, 14, 0, 0, 0, 0, loc)
+	end := time.Date(2015, time.November, 18, 17, 0, 0, 0, loc)
+
+	s := NewState(time.Wednesday)
+	s.AddPerson("joe", 0)
+	s.AddPerson("bob", 1)
+	r := s.Default()
+	r.Schedule = s.BuildSchedule(start, end)
+	first := r.Schedule.ShiftsList[0]
+	worker := first.Worker().Identifier()
+
+	// part way through the first shift, whoever's on it has their priority
+	// raised so far that a fresh build wouldn't give them any shift
+	now := first.Start().Add(time.Hour * 24 * 3)
+	s.CommitShifts(now)
+	r.Members[worker].PriorityNum = 100
+	r.Schedule = s.BuildSchedule(now, end)
+	if r.Schedule.ShiftsList[0].Worker().Identifier() != worker || !r.Schedule.ShiftsList[0].Start().Equal(first.Start()) {
+		t.Fatalf("The shift in progress should have been kept:\n%v", r.Schedule)
+	}
+	if r.Schedule.ShiftsList[1].Worker().Identifier() == worker || !r.Schedule.ShiftsList[1].Start().Equal(first.End()) {
+		t.Fatalf("The next shift should follow on from the one in progress:\n%v", r.Schedule)
+	}
+
+	s.CommitShifts(first.End())
+	if len(s.History) != 1 || s.History[0].Worker != worker || !s.History[0].Start().Equal(first.Start()) {
+		t.Fatalf("The whole shift should have been committed: %v", s.History)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	loc := inChicago(t)
+	start := time.Date(2015, time.October, 11, 22, 0, 0, 0, loc)
+	end := time.Date(2015, time.November, 18, 17, 0, 0, 0, loc)
+
+	s := NewState(time.Wednesday)
+	s.AddPerson("joe", 0)
+	s.AddPerson("bob", 0)
+	s.Default().Schedule = s.BuildSchedule(start, end)
+	s.Default().Schedule.AddShift(s.People["joe"], time.Date(2015, time.October, 22, 0, 0, 0, 0, loc),
+		time.Date(2015, time.October, 23, 0, 0, 0, 0, loc))
+	s.CommitShifts(time.Date(2015, time.October, 29, 0, 0, 0, 0, loc))
+
+	// Oct 7-14, Oct 14-21, Oct 21-22, Oct 22-23 (edited), Oct 23-28
+	if len(s.History) != 5 {
+		t.Fatalf("Expected 5 shifts in the history, got: %v", s.History)
+	}
+	if s.History[3].Worker != "joe" || s.History[3].Change != EDITED {
+		t.Fatalf("Expected joe's edited shift, got: %v", s.History[3])
+	}
+
+	since := time.Date(2015, time.October, 20, 0, 0, 0, 0, loc)
+	for _, args := range []string{"joe 20151020", "joe since 20151020"} {
+		msg := historyCmd(command{action: "history", args: strings.Fields(args)}, s)
+		for _, r := range s.HistorySince(DEFAULT_ROTATION, "joe", since) {
+			if !strings.Contains(msg, r.String()) {
+				t.Fatalf("history %v is missing %v: %v", args, r, msg)
+			}
+		}
+		if strings.Contains(msg, "bob") {
+			t.Fatalf("history %v shouldn't mention bob: %v", args, msg)
+		}
+	}
+	msg := historyCmd(command{action: "history", args: []string{"since", "20151020"}}, s)
+	for _, r := range s.HistorySince(DEFAULT_ROTATION, "", since) {
+		if !strings.Contains(msg, r.String()) {
+			t.Fatalf("history since 20151020 is missing %v: %v", r, msg)
+		}
+	}
+	if strings.Contains(msg, s.History[0].String()) {
+		t.Fatalf("history since 20151020 shouldn't include %v: %v", s.History[0], msg)
+	}
+
+	summary := summarizeHistory(s.History)
+	if !strings.Contains(summary, "bob: ") || !strings.Contains(summary, "joe: ") {
+		t.Fatalf("Expected totals for joe and bob, got: %v", summary)
+	}
+}
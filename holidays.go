@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The directory holiday import reads files from, set by the -holidays
+// flag. Import is turned off if it's "", since anyone who can talk to sked
+// can run it.
+var holidayDir string
+
+// readHolidayFile reads the file called name in holidayDir. name has to be
+// just the name of a file, so nothing outside the directory can be read.
+func readHolidayFile(name string) ([]byte, error) {
+	if holidayDir == "" {
+		return nil, errors.New("Importing holidays is turned off - start sked with -holidays <dir> to import files from that directory")
+	}
+	if name != filepath.Base(name) || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return nil, fmt.Errorf("%v isn't the name of a file in the holidays directory", name)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(holidayDir, name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("There's no file called %v in the holidays directory", name)
+	}
+	return data, err
+}
+
+// ParseHolidays reads holidays from an iCalendar file, a CSV file of
+// "date,name" rows, or a simple YAML list like "- 2015-12-25: Christmas".
+// The format is worked out from filename's extension, or failing that
+// from the contents. Dates are whole days in loc.
+func ParseHolidays(filename string, data []byte, loc *time.Location) ([]Holiday, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".ics", ".ical":
+		return parseICS(data, loc)
+	case ".csv":
+		return parseHolidayCSV(data, loc)
+	case ".yaml", ".yml":
+		return parseHolidayYAML(data, loc)
+	}
+	switch {
+	case bytes.Contains(data, []byte("BEGIN:VCALENDAR")):
+		return parseICS(data, loc)
+	case bytes.Contains(data, []byte(": ")) || bytes.HasPrefix(bytes.TrimSpace(data), []byte("-")):
+		return parseHolidayYAML(data, loc)
+	}
+	return parseHolidayCSV(data, loc)
+}
+
+// ImportHolidays adds holidays, renaming any which were already there, and
+// returns how many there were.
+func (s *State) ImportHolidays(holidays []Holiday) int {
+	for _, h := range holidays {
+		s.AddHoliday(h.Date, h.Name)
+	}
+	return len(holidays)
+}
+
+// parseICS reads the all day events in an iCalendar file. An event which
+// lasts several days is a holiday on each of them.
+func parseICS(data []byte, loc *time.Location) ([]Holiday, error) {
+	holidays := []Holiday{}
+	var start, end time.Time
+	var name string
+	inEvent := false
+	for n, line := range unfoldICS(data) {
+		key, value, ok := splitICSLine(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case key == "BEGIN" && value == "VEVENT":
+			inEvent = true
+			start, end, name = time.Time{}, time.Time{}, ""
+		case key == "END" && value == "VEVENT":
+			inEvent = false
+			if start.IsZero() {
+				return nil, fmt.Errorf("The event ending on line %v has no DTSTART", n+1)
+			}
+			if !end.After(start) {
+				end = start.AddDate(0, 0, 1)
+			}
+			for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+				holidays = append(holidays, Holiday{day, name})
+			}
+		case !inEvent:
+			continue
+		case key == "SUMMARY":
+			name = unescapeICS(value)
+		case key == "DTSTART" || key == "DTEND":
+			date, err := parseHolidayDate(value, loc)
+			if err != nil {
+				return nil, fmt.Errorf("Line %v: %v", n+1, err)
+			}
+			if key == "DTSTART" {
+				start = date
+			} else {
+				end = date
+			}
+		}
+	}
+	if len(holidays) == 0 {
+		return nil, errors.New("There are no events in the calendar")
+	}
+	return holidays, nil
+}
+
+// unfoldICS splits data into lines, joining lines which were folded by
+// starting the continuation with a space or tab.
+func unfoldICS(data []byte) []string {
+	lines := []string{}
+	for _, line := range strings.Split(strings.Replace(string(data), "\r\n", "\n", -1), "\n") {
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// splitICSLine splits e.g. "DTSTART;VALUE=DATE:20151225" into the name
+// DTSTART and the value 20151225, dropping any parameters.
+func splitICSLine(line string) (string, string, bool) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return "", "", false
+	}
+	key := line[:colon]
+	if semi := strings.Index(key, ";"); semi >= 0 {
+		key = key[:semi]
+	}
+	return strings.ToUpper(strings.TrimSpace(key)), strings.TrimSpace(line[colon+1:]), true
+}
+
+func unescapeICS(s string) string {
+	return strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\N`, " ", `\\`, `\`).Replace(s)
+}
+
+// parseHolidayCSV reads "date,name" rows. The name is optional, and a
+// first row that doesn't start with a date is taken to be a header.
+func parseHolidayCSV(data []byte, loc *time.Location) ([]Holiday, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	holidays := []Holiday{}
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		date, err := parseHolidayDate(record[0], loc)
+		if err != nil {
+			if row == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("Row %v: %v", row, err)
+		}
+		name := ""
+		if len(record) > 1 {
+			name = strings.TrimSpace(record[1])
+		}
+		holidays = append(holidays, Holiday{date, name})
+	}
+	if len(holidays) == 0 {
+		return nil, errors.New("There are no holidays in the list")
+	}
+	return holidays, nil
+}
+
+// parseHolidayYAML reads the simple kinds of YAML list people write
+// holidays in:
+//
+//	2015-12-25: Christmas
+//	- 2016-01-01: New Year's Day
+//	- date: 2016-07-04
+//	  name: Independence Day
+//
+// optionally under a top level key like "holidays:". It isn't a YAML
+// parser, anything else is an error.
+func parseHolidayYAML(data []byte, loc *time.Location) ([]Holiday, error) {
+	holidays := []Holiday{}
+	// the entry being read in the date:/name: form
+	current := -1
+	for n, line := range strings.Split(string(data), "\n") {
+		if comment := strings.Index(line, " #"); comment >= 0 {
+			line = line[:comment]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+		item := strings.HasPrefix(line, "- ")
+		if item {
+			line = strings.TrimSpace(line[2:])
+			current = -1
+		}
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			return nil, fmt.Errorf("Line %v: I don't understand it, try <date>: <name>", n+1)
+		}
+		key := unquoteYAML(line[:colon])
+		value := unquoteYAML(line[colon+1:])
+		switch {
+		case key == "date":
+			date, err := parseHolidayDate(value, loc)
+			if err != nil {
+				return nil, fmt.Errorf("Line %v: %v", n+1, err)
+			}
+			if current >= 0 && holidays[current].Date.IsZero() {
+				holidays[current].Date = date
+			} else {
+				holidays = append(holidays, Holiday{Date: date})
+				current = len(holidays) - 1
+			}
+		case key == "name":
+			if current >= 0 {
+				holidays[current].Name = value
+			} else {
+				holidays = append(holidays, Holiday{Name: value})
+				current = len(holidays) - 1
+			}
+		case value == "" && !item:
+			// a top level key like "holidays:"
+		default:
+			date, err := parseHolidayDate(key, loc)
+			if err != nil {
+				return nil, fmt.Errorf("Line %v: %v", n+1, err)
+			}
+			holidays = append(holidays, Holiday{date, value})
+			current = -1
+		}
+	}
+	for i, h := range holidays {
+		if h.Date.IsZero() {
+			return nil, fmt.Errorf("Holiday %v in the list has no date", i+1)
+		}
+	}
+	if len(holidays) == 0 {
+		return nil, errors.New("There are no holidays in the list")
+	}
+	return holidays, nil
+}
+
+func unquoteYAML(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// parseHolidayDate reads a date like 2015-12-25, 20151225 or
+// 20151225T000000Z and returns midnight at the start of that day in loc.
+// Any time of day is ignored, holidays are whole days. The error doesn't
+// repeat s, so importing a file that isn't a list of holidays doesn't show
+// what's in it.
+func parseHolidayDate(s string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"2006-01-02", "20060102", "2006/01/02"} {
+		if len(s) < len(layout) {
+			continue
+		}
+		if date, err := time.ParseInLocation(layout, s[:len(layout)], loc); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, errors.New("I don't understand the date, try 2015-12-25")
+}
+
+// holidaysDuring returns the holidays any of i falls on, in order. Days
+// are in i's own time zone, the same as the weigher.
+func (s *State) holidaysDuring(i Intervaler) []Holiday {
+	holidays := []Holiday{}
+	for day := atMidnight(i.Start()); day.Before(i.End()); day = day.AddDate(0, 0, 1) {
+		if h, ok := s.holiday(day); ok {
+			holidays = append(holidays, h)
+		}
+	}
+	return holidays
+}
+
+// FormatSchedule is sched.Format(loc) with the holidays each shift covers
+// after it.
+func (s *State) FormatSchedule(sched *Schedule, loc *time.Location) string {
+	lines := make([]string, len(sched.ShiftsList))
+	for i, shift := range sched.ShiftsList {
+		lines[i] = shift.Format(loc)
+		holidays := s.holidaysDuring(shift)
+		if len(holidays) == 0 {
+			continue
+		}
+		names := make([]string, len(holidays))
+		for j, h := range holidays {
+			names[j] = h.String()
+		}
+		lines[i] += " - " + strings.Join(names, ", ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// moveHandoffs moves any handoff in sched which falls on a holiday to the
+// same time on the next day which isn't one, so whoever is on for the day
+// before covers the holiday rather than two people splitting it. A
+// handoff isn't moved past the end of the shift after it.
+func (s *State) moveHandoffs(sched *Schedule) {
+	for i := 1; i < len(sched.ShiftsList); i++ {
+		shift := sched.ShiftsList[i]
+		handoff := shift.Start()
+		for {
+			if _, ok := s.holiday(handoff); !ok {
+				break
+			}
+			handoff = handoff.AddDate(0, 0, 1)
+		}
+		if handoff.Equal(shift.Start()) || !handoff.Before(shift.End()) {
+			continue
+		}
+		sched.ShiftsList[i-1].SetEnd(handoff)
+		shift.SetStart(handoff)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHolidays(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	day := func(m time.Month, d int) time.Time {
+		return time.Date(2015, m, d, 0, 0, 0, 0, loc)
+	}
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20151225",
+		"DTEND;VALUE=DATE:20151226",
+		"SUMMARY:Christmas Day",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20151126",
+		"DTEND;VALUE=DATE:20151128",
+		"SUMMARY:Thanksgiving\\, and the",
+		"  day after",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+	csv := "date,name\n2015-12-25,Christmas Day\n2015-11-26, \"Thanksgiving\"\n"
+	yaml := `holidays:
+  - 2015-12-25: Christmas Day  # the big one
+  - date: 2015-11-26
+    name: "Thanksgiving"
+`
+	tests := []struct {
+		filename string
+		data     string
+		expected []Holiday
+	}{
+		{"us.ics", ics, []Holiday{{day(12, 25), "Christmas Day"},
+			{day(11, 26), "Thanksgiving, and the day after"}, {day(11, 27), "Thanksgiving, and the day after"}}},
+		{"us.csv", csv, []Holiday{{day(12, 25), "Christmas Day"}, {day(11, 26), "Thanksgiving"}}},
+		{"us.yaml", yaml, []Holiday{{day(12, 25), "Christmas Day"}, {day(11, 26), "Thanksgiving"}}},
+		// worked out from the contents
+		{"holidays", ics, []Holiday{{day(12, 25), "Christmas Day"},
+			{day(11, 26), "Thanksgiving, and the day after"}, {day(11, 27), "Thanksgiving, and the day after"}}},
+		{"holidays", csv, []Holiday{{day(12, 25), "Christmas Day"}, {day(11, 26), "Thanksgiving"}}},
+		{"holidays", yaml, []Holiday{{day(12, 25), "Christmas Day"}, {day(11, 26), "Thanksgiving"}}},
+	}
+	for _, test := range tests {
+		holidays, err := ParseHolidays(test.filename, []byte(test.data), loc)
+		if err != nil {
+			t.Fatalf("Couldn't parse %v: %v", test.filename, err)
+		}
+		if len(holidays) != len(test.expected) {
+			t.Fatalf("Expected %v from %v, got %v", test.expected, test.filename, holidays)
+		}
+		for i, h := range holidays {
+			if !h.Date.Equal(test.expected[i].Date) || h.Name != test.expected[i].Name {
+				t.Fatalf("Expected %v from %v, got %v", test.expected, test.filename, holidays)
+			}
+		}
+	}
+
+	for _, bad := range []struct{ filename, data string }{
+		{"us.csv", "2015-12-25,Christmas\nDec 26,Boxing Day\n"},
+		{"us.yaml", "- name: Christmas\n"},
+		{"us.yaml", "Christmas\n"},
+		{"us.ics", "BEGIN:VCALENDAR\nEND:VCALENDAR\n"},
+	} {
+		if _, err := ParseHolidays(bad.filename, []byte(bad.data), loc); err == nil {
+			t.Fatalf("%q shouldn't parse", bad.data)
+		}
+	}
+}
+
+func TestHolidayHandoffs(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	dir, err := ioutil.TempDir("", "sked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "holidays.csv")
+	// Monday and Tuesday
+	ioutil.WriteFile(filename, []byte("2015-12-28,Day off\n2015-12-29,Another day off\n"), 0644)
+
+	s := NewState(time.Wednesday)
+	s.AddPerson("joe", 0)
+	s.AddPerson("bob", 1)
+	r := s.Default()
+	msg := holidayCmd(command{action: "holiday", args: []string{"import", "holidays.csv"}}, s)
+	if !strings.HasPrefix(msg, "Importing holidays is turned off") {
+		t.Fatalf("Import should be off without a holidays directory, got: %v", msg)
+	}
+	holidayDir = dir
+	defer func() { holidayDir = "" }()
+	for _, name := range []string{filename, "../holidays.csv", ".."} {
+		msg = holidayCmd(command{action: "holiday", args: []string{"import", name}}, s)
+		if !strings.HasSuffix(msg, "isn't the name of a file in the holidays directory") {
+			t.Fatalf("%v is outside the holidays directory, got: %v", name, msg)
+		}
+	}
+	ioutil.WriteFile(filepath.Join(dir, "secret.csv"), []byte("date,name\nroot:x:0:0,root\n"), 0644)
+	msg = holidayCmd(command{action: "holiday", args: []string{"import", "secret.csv"}}, s)
+	if strings.Contains(msg, "root") {
+		t.Fatalf("The error shouldn't show what's in the file, got: %v", msg)
+	}
+	msg = holidayCmd(command{action: "holiday", args: []string{"import", "holidays.csv"}}, s)
+	if msg != "Added 2 holidays - build to apply them to the schedule" {
+		t.Fatalf("Unexpected response from holiday import: %v", msg)
+	}
+	cadenceCmd(command{action: "cadence", args: []string{"weekly", "mon", "10:00", "skip-holidays"}}, s)
+
+	start := time.Date(2015, time.December, 22, 0, 0, 0, 0, loc)
+	sched, _ := s.BuildRotation(r, start, start.AddDate(0, 0, 14), loc)
+	handoff := time.Date(2015, time.December, 30, 10, 0, 0, 0, loc)
+	if !sched.ShiftsList[0].End().Equal(handoff) || !sched.ShiftsList[1].Start().Equal(handoff) {
+		t.Fatalf("The handoff should have moved to the wednesday:\n%v", sched.Format(loc))
+	}
+	if !sched.ShiftsList[1].End().Equal(time.Date(2016, time.January, 4, 10, 0, 0, 0, loc)) {
+		t.Fatalf("The next handoff shouldn't have moved:\n%v", sched.Format(loc))
+	}
+
+	lines := strings.Split(s.FormatSchedule(sched, loc), "\n")
+	if !strings.HasSuffix(lines[0], " - Mon Dec 28 2015 Day off, Tue Dec 29 2015 Another day off") {
+		t.Fatalf("The first shift should list its holidays: %v", lines[0])
+	}
+	if strings.Contains(lines[1], " - ") {
+		t.Fatalf("The second shift has no holidays: %v", lines[1])
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// How times are written in iCalendar files, always in UTC
+const ICS_TIME_FORMAT = "20060102T150405Z"
+
+// ICS returns an iCalendar file with an event for each shift someone works
+// in the named rotations, or in every rotation if there are none, only
+// counting shifts worked by person unless it's "". now is when the file
+// was made.
+func (s *State) ICS(rotations []string, person string, now time.Time) (string, error) {
+	if len(rotations) == 0 {
+		rotations = s.RotationNames()
+	}
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//jaffee//sked//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + escapeICS(calendarName(rotations, person)),
+	}
+	for _, name := range rotations {
+		r, ok := s.Rotations[name]
+		if !ok {
+			return "", fmt.Errorf("There's no rotation called %v", name)
+		}
+		if r.Schedule == nil {
+			continue
+		}
+		for _, shift := range r.Schedule.ShiftsList {
+			worker := shift.Worker().Identifier()
+			if worker == EMPTY_WORKER || (person != "" && worker != person) {
+				continue
+			}
+			lines = append(lines, shiftEvent(r, shift, now)...)
+		}
+	}
+	lines = append(lines, "END:VCALENDAR")
+	for i, line := range lines {
+		lines[i] = foldICS(line)
+	}
+	return strings.Join(lines, "\r\n") + "\r\n", nil
+}
+
+func calendarName(rotations []string, person string) string {
+	name := "sked " + strings.Join(rotations, ", ")
+	if person != "" {
+		name += " for " + person
+	}
+	return name
+}
+
+// shiftEvent returns the lines of the event for shift in r. The UID stays
+// the same when the schedule is rebuilt, so calendar apps update the event
+// instead of adding another.
+func shiftEvent(r *Rotation, shift *Shift, now time.Time) []string {
+	worker := shift.Worker().Identifier()
+	lines := []string{
+		"BEGIN:VEVENT",
+		fmt.Sprintf("UID:%v-%v@sked", r.Name, shift.Start().Unix()),
+		"DTSTAMP:" + now.UTC().Format(ICS_TIME_FORMAT),
+		"DTSTART:" + shift.Start().UTC().Format(ICS_TIME_FORMAT),
+		"DTEND:" + shift.End().UTC().Format(ICS_TIME_FORMAT),
+		"SUMMARY:" + escapeICS(fmt.Sprintf("%v on %v", worker, r.Name)),
+	}
+	if shift.Change != UNCHANGED {
+		lines = append(lines, "DESCRIPTION:"+escapeICS(fmt.Sprintf("This shift was %v", shift.Change)))
+	}
+	return append(lines, "TRANSP:TRANSPARENT", "END:VEVENT")
+}
+
+func escapeICS(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// foldICS splits line into lines of at most 75 bytes, each continuation
+// starting with a space, without splitting any characters.
+func foldICS(line string) string {
+	folded := ""
+	for len(line) > 75 {
+		n := 75
+		if folded != "" {
+			// leave room for the leading space
+			n = 74
+		}
+		for n > 0 && !utf8.RuneStart(line[n]) {
+			n--
+		}
+		folded += line[:n] + "\r\n "
+		line = line[n:]
+	}
+	return folded + line
+}
+
+// exportMain writes the schedule out as an iCalendar file, for
+// "sked export".
+func exportMain(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	replay := flags.Bool("replay", false, "rebuild the state by replaying the command log instead of loading the state snapshot")
+	db := flags.String("db", "", "read the state from a bbolt database at this path instead of "+DEFAULT_STORAGE_ID)
+	rotation := flags.String("rotation", "", "only export the named rotation's schedule, all of them if empty")
+	person := flags.String("person", "", "only export the named person's shifts, everyone's if empty")
+	out := flags.String("o", "sked.ics", "the file to write the calendar to")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sked export [-replay] [-db path] [-rotation name] [-person name] [-o file] [log-file]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	filename := "sked-log.txt"
+	if flags.NArg() >= 1 {
+		filename = flags.Arg(0)
+	}
+
+	s := loadState(filename, *db, *replay, newCommandMap())
+	defer s.store().Close()
+	rotations := []string{}
+	if *rotation != "" {
+		rotations = append(rotations, *rotation)
+	}
+	if _, ok := s.People[*person]; *person != "" && !ok {
+		fmt.Fprintf(os.Stderr, "There's no one called %v\n", *person)
+		os.Exit(1)
+	}
+	ics, err := s.ICS(rotations, *person, time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := ioutil.WriteFile(*out, []byte(ics), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not write %v, error: %v\n", *out, err)
+		os.Exit(1)
+	}
+}
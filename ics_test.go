@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestICS(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, time.October, 14, 0, 0, 0, 0, loc)
+	now := time.Date(2015, time.October, 13, 12, 0, 0, 0, time.UTC)
+	s := NewState(time.Wednesday)
+	s.AddPerson("joe", 0)
+	s.AddPerson("bob", 1)
+	r := s.Default()
+	r.Schedule, _ = s.BuildRotation(r, start, start.AddDate(0, 0, 27), loc)
+
+	ics, err := s.ICS(nil, "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\n") || !strings.HasSuffix(ics, "END:VCALENDAR\r\n") {
+		t.Fatalf("Not a calendar:\n%v", ics)
+	}
+	if n := strings.Count(ics, "BEGIN:VEVENT"); n != r.Schedule.NumShifts() {
+		t.Fatalf("Expected %v events, got %v:\n%v", r.Schedule.NumShifts(), n, ics)
+	}
+	first := r.Schedule.ShiftsList[0]
+	event := strings.Join([]string{
+		"BEGIN:VEVENT",
+		"UID:support-1444798800@sked",
+		"DTSTAMP:20151013T120000Z",
+		"DTSTART:20151014T050000Z",
+		"DTEND:20151021T050000Z",
+		"SUMMARY:" + first.Worker().Identifier() + " on support",
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+	}, "\r\n")
+	if !strings.Contains(ics, event) {
+		t.Fatalf("Expected the event\n%v\nin\n%v", event, ics)
+	}
+
+	ics, err = s.ICS([]string{"support"}, "bob", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(ics, "joe on") || strings.Count(ics, "BEGIN:VEVENT") != r.Schedule.NumShifts()/2 {
+		t.Fatalf("Expected only bob's shifts:\n%v", ics)
+	}
+	if _, err = s.ICS([]string{"nope"}, "", now); err == nil {
+		t.Fatalf("There's no rotation called nope")
+	}
+
+	for _, line := range strings.Split(foldICS("SUMMARY:"+strings.Repeat("é", 100)), "\r\n") {
+		if len(line) > 75 {
+			t.Fatalf("Line is too long: %q", line)
+		}
+	}
+}
@@ -1,10 +1,27 @@
 package main
 
+import (
+	"strings"
+	"time"
+)
+
 type Person struct {
-	Name           string
+	Name string
+	// Times this person can't work, each an *Unavailable
 	Unavailability []Intervaler
-	PriorityNum    int
-	OrderNum       int
+	// Windows of time which repeat that this person can't work
+	Recurring []Recurrence
+	// Times this person would rather or would rather not work
+	Preferences []Preference
+	// The last ID given to one of this person's unavailabilities or
+	// preferences. IDs are never reused, so they stay the same as others
+	// are added, removed or pruned.
+	LastID      int
+	PriorityNum int
+	OrderNum    int
+	SlackID     string
+	// IANA time zone, e.g. America/Chicago - "" means sked's own
+	TZ string
 }
 
 func NewPerson(name string) *Person {
@@ -21,17 +38,126 @@ func (p *Person) IsAvailable(i Intervaler) bool {
 			return false
 		}
 	}
+	for _, r := range p.Recurring {
+		if r.Overlaps(i, p.Location()) {
+			return false
+		}
+	}
 	return true
 }
 
+// An Unavailable is a one-off time someone can't work. Its ID stays the
+// same however many others are added, removed or pruned, so it can be
+// referred to by it.
+type Unavailable struct {
+	*Interval
+	ID int
+}
+
+// nextID returns a new ID for one of p's unavailabilities or preferences.
+func (p *Person) nextID() int {
+	p.LastID += 1
+	return p.LastID
+}
+
 func (p *Person) AddUnavailable(i Intervaler) {
-	p.Unavailability = append(p.Unavailability, i)
+	p.Unavailability = append(p.Unavailability, &Unavailable{&Interval{i.Start(), i.End()}, p.nextID()})
+}
+
+func (p *Person) AddRecurring(r Recurrence) {
+	r.ID = p.nextID()
+	p.Recurring = append(p.Recurring, r)
+}
+
+// RemoveUnavailable drops p's one-off or recurring unavailability with the
+// given ID, and returns whether there was one.
+func (p *Person) RemoveUnavailable(id int) bool {
+	for i, u := range p.Unavailability {
+		if u.(*Unavailable).ID == id {
+			p.Unavailability = append(p.Unavailability[:i], p.Unavailability[i+1:]...)
+			return true
+		}
+	}
+	for i, r := range p.Recurring {
+		if r.ID == id {
+			p.Recurring = append(p.Recurring[:i], p.Recurring[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// fillIDs gives an ID to each of p's unavailabilities and preferences which
+// were saved before they had them.
+func (p *Person) fillIDs() {
+	for i, u := range p.Unavailability {
+		if unavailable, ok := u.(*Unavailable); !ok || unavailable.ID == 0 {
+			p.Unavailability[i] = &Unavailable{&Interval{u.Start(), u.End()}, p.nextID()}
+		}
+	}
+	for i := range p.Recurring {
+		if p.Recurring[i].ID == 0 {
+			p.Recurring[i].ID = p.nextID()
+		}
+	}
+	for i := range p.Preferences {
+		if p.Preferences[i].ID == 0 {
+			p.Preferences[i].ID = p.nextID()
+		}
+	}
+}
+
+// PruneUnavailable drops the one-off unavailabilities which are over by
+// now, and returns whether there were any.
+func (p *Person) PruneUnavailable(now time.Time) bool {
+	kept := p.Unavailability[:0]
+	for _, u := range p.Unavailability {
+		if u.End().After(now) {
+			kept = append(kept, u)
+		}
+	}
+	pruned := len(kept) != len(p.Unavailability)
+	p.Unavailability = kept
+	return pruned
 }
 
 func (p *Person) Identifier() string {
 	return p.Name
 }
 
+// SlackUser returns the Slack user ID to contact this person at. People
+// who were added by mentioning them (e.g. "add <@U024BE7LH>") don't need
+// to have it set explicitly.
+func (p *Person) SlackUser() string {
+	if p.SlackID != "" {
+		return p.SlackID
+	}
+	return parseUser(p.Name)
+}
+
+// Location returns the time zone to show this person times in, and to
+// understand the dates they type in.
+func (p *Person) Location() *time.Location {
+	if p.TZ == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(p.TZ)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// Slack sends user references as <@U024BE7LH> or <@U024BE7LH|bob> - pull
+// out the ID. Returns "" if ref isn't a user reference.
+func parseUser(ref string) string {
+	if strings.HasPrefix(ref, "<@") && strings.HasSuffix(ref, ">") {
+		ref = strings.TrimSuffix(strings.TrimPrefix(ref, "<@"), ">")
+		return strings.SplitN(ref, "|", 2)[0]
+	}
+	return ""
+}
+
 func (p *Person) Priority() int {
 	return p.PriorityNum
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// A Preference is a time someone would rather (or would rather not) work.
+// Unlike unavailability, BuildSchedule will go against a preference if it
+// has to.
+type Preference struct {
+	*Interval
+	// Whether they'd like to work then, otherwise they'd rather not
+	Prefer bool
+	// What it's referred to by, see Person.LastID
+	ID int
+}
+
+func (p *Person) AddPreference(i Intervaler, prefer bool) {
+	p.Preferences = append(p.Preferences, Preference{&Interval{i.Start(), i.End()}, prefer, p.nextID()})
+}
+
+// RemovePreference drops p's preference with the given ID, and returns
+// whether there was one.
+func (p *Person) RemovePreference(id int) bool {
+	for i, pref := range p.Preferences {
+		if pref.ID == id {
+			p.Preferences = append(p.Preferences[:i], p.Preferences[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// PreferenceFor returns -1 if p would rather not work any of i, 1 if
+// they'd like to work some of it, and 0 if they don't mind.
+func (p *Person) PreferenceFor(i Intervaler) int {
+	preference := 0
+	for _, pref := range p.Preferences {
+		if !pref.Overlaps(i) {
+			continue
+		}
+		if !pref.Prefer {
+			return -1
+		}
+		preference = 1
+	}
+	return preference
+}
+
+// PrunePreferences drops the preferences which are over by now, and
+// returns whether there were any.
+func (p *Person) PrunePreferences(now time.Time) bool {
+	kept := p.Preferences[:0]
+	for _, pref := range p.Preferences {
+		if pref.End().After(now) {
+			kept = append(kept, pref)
+		}
+	}
+	pruned := len(kept) != len(p.Preferences)
+	p.Preferences = kept
+	return pruned
+}
+
+// preferenceWarnings describes the preferences which were overridden by
+// giving shift to worker, out of everyone in personList, with recent being
+// who worked the shifts just before it. Times are shown in loc.
+func preferenceWarnings(personList []*Person, worker *Person, shift Shifter, recent []string, loc *time.Location) []string {
+	warnings := []string{}
+	when := fmt.Sprintf("%v to %v", shift.Start().In(loc).Format(TIME_FORMAT), shift.End().In(loc).Format(TIME_FORMAT))
+	if worker.PreferenceFor(shift) < 0 {
+		warnings = append(warnings, fmt.Sprintf("%v would rather not work %v, but %v", worker.Identifier(), when,
+			overriddenBecause(personList, worker, shift, recent)))
+	}
+	for _, p := range personList {
+		if p.Identifier() != worker.Identifier() && p.PreferenceFor(shift) > 0 && p.IsAvailable(shift) {
+			warnings = append(warnings, fmt.Sprintf("%v wanted to work %v, but %v did", p.Identifier(), when, worker.Identifier()))
+		}
+	}
+	return warnings
+}
+
+// overriddenBecause says why worker had to work shift even though they'd
+// rather not have.
+func overriddenBecause(personList []*Person, worker *Person, shift Intervaler, recent []string) string {
+	others, resting, unwilling := 0, 0, 0
+	for _, p := range personList {
+		if p.Identifier() == worker.Identifier() || !p.IsAvailable(shift) {
+			continue
+		}
+		others += 1
+		if !rested(p, recent) {
+			resting += 1
+		} else if p.PreferenceFor(shift) < 0 {
+			unwilling += 1
+		}
+	}
+	switch {
+	case others == 0:
+		return "no one else could"
+	case resting == others:
+		return "everyone else who could needed a rest"
+	case unwilling == others:
+		return "everyone else who could would rather not too"
+	case resting+unwilling == others:
+		return "everyone else who could needed a rest or would rather not too"
+	}
+	// the solver can go against a preference to spread the load
+	return "giving it to anyone else would have made the load less even"
+}
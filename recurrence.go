@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A Recurrence is a window of time which repeats, e.g. every friday, every
+// weekend, or 09:00 to 17:00 on the 2nd monday of each month. It's
+// evaluated lazily against whatever interval it's asked about, in a given
+// time zone, so it never runs out.
+type Recurrence struct {
+	// The days the window starts on, every day if empty
+	Weekdays []time.Weekday
+	// Only the Nth of those weekdays in each month, or the last one if -1.
+	// 0 means every week.
+	Nth int
+	// The window is from StartHour:StartMinute to EndHour:EndMinute, all
+	// day if they're all zero. If the end isn't after the start, the
+	// window runs overnight into the next day.
+	StartHour   int
+	StartMinute int
+	EndHour     int
+	EndMinute   int
+	// What it's referred to by once it's given to someone, see
+	// Person.LastID
+	ID int
+}
+
+// Overlaps returns whether any occurrence of the window, with days in loc,
+// overlaps i.
+func (r Recurrence) Overlaps(i Intervaler, loc *time.Location) bool {
+	start := i.Start().In(loc)
+	// an overnight window from the day before could reach into i
+	day := time.Date(start.Year(), start.Month(), start.Day()-1, 0, 0, 0, 0, loc)
+	for day.Before(i.End()) {
+		if r.occursOn(day) {
+			window, err := NewInterval(r.window(day))
+			if err == nil && window.Overlaps(i) {
+				return true
+			}
+		}
+		day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, loc)
+	}
+	return false
+}
+
+// occursOn returns whether a window starts on day.
+func (r Recurrence) occursOn(day time.Time) bool {
+	if len(r.Weekdays) > 0 {
+		found := false
+		for _, weekday := range r.Weekdays {
+			if day.Weekday() == weekday {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	switch {
+	case r.Nth == -1:
+		return day.AddDate(0, 0, 7).Month() != day.Month()
+	case r.Nth > 0:
+		return (day.Day()-1)/7+1 == r.Nth
+	}
+	return true
+}
+
+// window returns the start and end of the window which starts on day.
+func (r Recurrence) window(day time.Time) (time.Time, time.Time) {
+	start := withClock(day, r.StartHour, r.StartMinute)
+	end := withClock(day, r.EndHour, r.EndMinute)
+	if !end.After(start) {
+		end = withClock(day.AddDate(0, 0, 1), r.EndHour, r.EndMinute)
+	}
+	return start, end
+}
+
+func (r Recurrence) String() string {
+	var days string
+	switch {
+	case len(r.Weekdays) == 0:
+		days = "day"
+	case sameWeekdays(r.Weekdays, []time.Weekday{time.Saturday, time.Sunday}):
+		days = "weekend"
+	case sameWeekdays(r.Weekdays, []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}):
+		days = "weekday"
+	default:
+		names := make([]string, len(r.Weekdays))
+		for i, weekday := range r.Weekdays {
+			names[i] = strings.ToLower(weekday.String())
+		}
+		days = strings.Join(names, ", ")
+	}
+	str := "every " + days
+	if r.Nth == -1 {
+		str = "the last " + days + " of every month"
+	} else if r.Nth > 0 {
+		str = fmt.Sprintf("the %v %v of every month", ordinal(r.Nth), days)
+	}
+	if r.StartHour != 0 || r.StartMinute != 0 || r.EndHour != 0 || r.EndMinute != 0 {
+		str += fmt.Sprintf(" from %02d:%02d to %02d:%02d", r.StartHour, r.StartMinute, r.EndHour, r.EndMinute)
+	}
+	return str
+}
+
+// ParseRecurrence understands what follows "every" in e.g. "every friday",
+// "every sat sun", "every weekend", "every weekday from 18:00 to 08:00",
+// "every 2nd monday" or "every last friday 9am to 5pm".
+func ParseRecurrence(args []string) (Recurrence, error) {
+	usage := errors.New("every [1st|2nd|3rd|4th|last] <day|weekday|weekend|monday ...> [[from] <time> to <time>]")
+	r := Recurrence{}
+	if len(args) == 0 {
+		return r, usage
+	}
+	if nth, ok := parseOrdinal(args[0]); ok {
+		r.Nth = nth
+		args = args[1:]
+	}
+	for len(args) > 0 {
+		word := strings.ToLower(strings.Trim(args[0], ","))
+		if word == "day" || word == "days" {
+			// every day, Weekdays stays empty
+		} else if word == "weekend" || word == "weekends" {
+			r.Weekdays = append(r.Weekdays, time.Saturday, time.Sunday)
+		} else if word == "weekday" || word == "weekdays" {
+			r.Weekdays = append(r.Weekdays, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday)
+		} else if weekday, ok := parseWeekday(strings.TrimSuffix(word, "s")); ok {
+			r.Weekdays = append(r.Weekdays, weekday)
+		} else if word == "and" {
+			// every saturday and sunday
+		} else {
+			break
+		}
+		args = args[1:]
+	}
+	if r.Nth != 0 && len(r.Weekdays) != 1 {
+		return r, errors.New("Say which day of the month, like every 2nd monday or every last friday")
+	}
+	if len(args) > 0 && strings.ToLower(args[0]) == "from" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return r, nil
+	}
+	if len(args) != 3 || args[1] != "to" {
+		return r, fmt.Errorf("I don't understand %v. %v", strings.Join(args, " "), usage)
+	}
+	var ok bool
+	r.StartHour, r.StartMinute, ok = parseTimeOfDay(args[0])
+	if !ok {
+		return r, fmt.Errorf("I don't understand the time %v, try 9:00 or 9am", args[0])
+	}
+	r.EndHour, r.EndMinute, ok = parseTimeOfDay(args[2])
+	if !ok {
+		return r, fmt.Errorf("I don't understand the time %v, try 17:00 or 5pm", args[2])
+	}
+	if r.StartHour == r.EndHour && r.StartMinute == r.EndMinute {
+		return r, errors.New("The window has to start and end at different times")
+	}
+	return r, nil
+}
+
+func parseOrdinal(s string) (int, bool) {
+	switch strings.ToLower(s) {
+	case "1st", "first":
+		return 1, true
+	case "2nd", "second":
+		return 2, true
+	case "3rd", "third":
+		return 3, true
+	case "4th", "fourth":
+		return 4, true
+	case "5th", "fifth":
+		return 5, true
+	case "last":
+		return -1, true
+	}
+	return 0, false
+}
+
+func ordinal(n int) string {
+	switch n {
+	case 1:
+		return "1st"
+	case 2:
+		return "2nd"
+	case 3:
+		return "3rd"
+	}
+	return fmt.Sprintf("%vth", n)
+}
+
+func sameWeekdays(a []time.Weekday, b []time.Weekday) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	tests := map[string]string{
+		"friday":                       "every friday",
+		"sat and sun":                  "every weekend",
+		"weekends":                     "every weekend",
+		"mon, wed":                     "every monday, wednesday",
+		"day from 18:00 to 8am":        "every day from 18:00 to 08:00",
+		"2nd monday":                   "the 2nd monday of every month",
+		"last friday 9am to 5pm":       "the last friday of every month from 09:00 to 17:00",
+		"weekday from 12:00 to 1:30pm": "every weekday from 12:00 to 13:30",
+	}
+	for args, expected := range tests {
+		r, err := ParseRecurrence(strings.Fields(args))
+		if err != nil {
+			t.Fatalf("Unexpected error parsing %v: %v", args, err)
+		}
+		if r.String() != expected {
+			t.Fatalf("%v should be %v, not %v", args, expected, r)
+		}
+	}
+	for _, bad := range []string{"", "2nd", "2nd mon tue", "friday blah", "friday 9am to 9am", "friday 9am to 25:00"} {
+		if _, err := ParseRecurrence(strings.Fields(bad)); err == nil {
+			t.Fatalf("Expected an error parsing %v", bad)
+		}
+	}
+}
+
+func TestRecurrenceOverlaps(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	day := func(d int, h int) time.Time {
+		// October 2015 starts on a Thursday
+		return time.Date(2015, time.October, d, h, 0, 0, 0, loc)
+	}
+	tests := []struct {
+		r        Recurrence
+		start    time.Time
+		end      time.Time
+		overlaps bool
+	}{
+		{Recurrence{Weekdays: []time.Weekday{time.Friday}}, day(5, 0), day(9, 0), false},
+		{Recurrence{Weekdays: []time.Weekday{time.Friday}}, day(5, 0), day(9, 1), true},
+		{Recurrence{Weekdays: []time.Weekday{time.Friday}}, day(10, 0), day(11, 0), false},
+		// overnight from thursday
+		{Recurrence{Weekdays: []time.Weekday{time.Thursday}, StartHour: 22, EndHour: 6}, day(9, 5), day(9, 7), true},
+		{Recurrence{Weekdays: []time.Weekday{time.Thursday}, StartHour: 22, EndHour: 6}, day(9, 6), day(9, 22), false},
+		{Recurrence{Weekdays: []time.Weekday{time.Monday}, Nth: 2}, day(5, 0), day(6, 0), false},
+		{Recurrence{Weekdays: []time.Weekday{time.Monday}, Nth: 2}, day(12, 10), day(12, 11), true},
+		{Recurrence{Weekdays: []time.Weekday{time.Friday}, Nth: -1}, day(23, 0), day(24, 0), false},
+		{Recurrence{Weekdays: []time.Weekday{time.Friday}, Nth: -1}, day(30, 0), day(31, 0), true},
+	}
+	for _, test := range tests {
+		i, _ := NewInterval(test.start, test.end)
+		if test.r.Overlaps(i, loc) != test.overlaps {
+			t.Fatalf("%v overlapping %v should be %v", test.r, i, test.overlaps)
+		}
+	}
+
+	// days are in the person's time zone
+	london, _ := time.LoadLocation("Europe/London")
+	fri := Recurrence{Weekdays: []time.Weekday{time.Friday}}
+	i, _ := NewInterval(day(8, 19), day(8, 20))
+	if !fri.Overlaps(i, london) || fri.Overlaps(i, loc) {
+		t.Fatalf("Thursday evening in Chicago is Friday in London")
+	}
+}
+
+func TestRecurringUnavailability(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, time.October, 11, 22, 0, 0, 0, loc)
+	end := time.Date(2015, time.November, 18, 17, 0, 0, 0, loc)
+	s := NewState(time.Wednesday)
+	s.AddPerson("joe", 0)
+	s.AddPerson("bob", 1)
+	s.Default().Cadence = Cadence{Days: 1}
+
+	msg := addUnavailable(command{action: "unavail", args: []string{"joe", "every", "friday"}}, s)
+	if msg != "Recorded: joe is unavailable every friday" {
+		t.Fatalf("Unexpected response from unavail: %v", msg)
+	}
+	sched := s.BuildSchedule(start, end)
+	for _, shift := range sched.ShiftsList {
+		worked := shift.Worker().Identifier()
+		if shift.Start().Weekday() == time.Friday && worked != "bob" {
+			t.Fatalf("joe can't work fridays: %v", shift)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reminderKey identifies the reminder for a particular rotation, worker,
+// shift and lead time.
+func reminderKey(r *Rotation, shift *Shift, lead time.Duration) string {
+	return fmt.Sprintf("%v|%v|%v|%v", r.Name, shift.Worker().Identifier(), shift.Start().Unix(), lead)
+}
+
+func (s *State) reminderSent(r *Rotation, shift *Shift, lead time.Duration) bool {
+	_, ok := s.SentReminders[reminderKey(r, shift, lead)]
+	return ok
+}
+
+func (s *State) markReminderSent(r *Rotation, shift *Shift, lead time.Duration) {
+	if s.SentReminders == nil {
+		s.SentReminders = make(map[string]time.Time)
+	}
+	s.SentReminders[reminderKey(r, shift, lead)] = shift.Start()
+	s.otherChanged()
+}
+
+// pruneReminders forgets about reminders for shifts which have already
+// started. Returns whether anything was removed.
+func (s *State) pruneReminders(now time.Time) bool {
+	pruned := false
+	for key, start := range s.SentReminders {
+		if start.Before(now) {
+			delete(s.SentReminders, key)
+			s.otherChanged()
+			pruned = true
+		}
+	}
+	return pruned
+}
+
+// parseLead understands anything time.ParseDuration does, plus whole days
+// like "2d".
+func parseLead(leadStr string) (time.Duration, error) {
+	if strings.HasSuffix(leadStr, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(leadStr, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * time.Hour * 24, nil
+	}
+	return time.ParseDuration(leadStr)
+}
+
+// formatLead prints a lead time the way people would type it.
+func formatLead(lead time.Duration) string {
+	lead = lead.Round(time.Minute)
+	if lead%time.Hour == 0 {
+		return fmt.Sprintf("%vh", int(lead.Hours()))
+	}
+	if lead < time.Hour {
+		return fmt.Sprintf("%vm", int(lead.Minutes()))
+	}
+	return strings.TrimSuffix(lead.String(), "0s")
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// The rotation commands apply to when none is named
+const DEFAULT_ROTATION = "support"
+
+// A Rotation is a list of people who take turns working shifts, e.g.
+// "support" or "oncall-db". Each rotation has its own schedule and
+// schedule parameters, and keeps track of its members' priorities
+// separately, so someone can be in several rotations.
+type Rotation struct {
+	Name     string
+	Members  map[string]*Member
+	Offset   time.Weekday
+	Cadence  Cadence
+	Schedule *Schedule
+	// Where shift handoffs are announced
+	Channel string
+	// How long before a shift starts its worker should be reminded
+	ReminderLeads []time.Duration
+	// Shifts ending at or before this have been committed to History
+	CommittedUntil time.Time
+	// How many shifts someone should have off between shifts
+	MinRest int
+	// One of STRATEGIES, "" means the first
+	Strategy string
+	// Seeds the random strategy
+	Seed int64
+	// Whether to build the schedule with the solver, and how long it can
+	// take - 0 means DEFAULT_SOLVER_BUDGET
+	Solver       bool
+	SolverBudget time.Duration
+	// How much more an hour on a weekend or holiday counts than any other,
+	// 0 means the default
+	WeekendWeight float64
+	HolidayWeight float64
+}
+
+// A Member is a person's place in a rotation.
+type Member struct {
+	Name        string
+	PriorityNum int
+	OrderNum    int
+}
+
+func NewRotation(name string, offset time.Weekday) *Rotation {
+	return &Rotation{
+		Name:    name,
+		Members: make(map[string]*Member),
+		Offset:  offset,
+		MinRest: 1,
+	}
+}
+
+// ShiftGenerator returns what the schedule should be divided up by - the
+// cadence if one has been set, otherwise weekly on the offset.
+func (r *Rotation) ShiftGenerator() ShiftGenerator {
+	if r.Cadence.Days == 0 {
+		return WeeklyCadence(r.Offset)
+	}
+	return r.Cadence
+}
+
+// inProgress returns a copy of the shift in r's schedule which has started
+// but not finished at t, if there is one.
+func (r *Rotation) inProgress(t time.Time) *Shift {
+	if r.Schedule == nil {
+		return nil
+	}
+	for _, shift := range r.Schedule.ShiftsList {
+		if shift.Start().Before(t) && shift.End().After(t) {
+			return &Shift{
+				Interval:    &Interval{shift.Start(), shift.End()},
+				WorkerThing: shift.Worker(),
+				Change:      shift.Change,
+			}
+		}
+	}
+	return nil
+}
+
+// MemberNames returns the names of everyone in the rotation, sorted.
+func (r *Rotation) MemberNames() []string {
+	names := make([]string, 0, len(r.Members))
+	for name := range r.Members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Default returns the rotation commands apply to when none is named.
+func (s *State) Default() *Rotation {
+	return s.Rotations[s.DefaultRotation]
+}
+
+// rotation returns the rotation cc was addressed to, or the default one.
+func (s *State) rotation(cc command) (*Rotation, error) {
+	if cc.rotation == "" {
+		if s.Default() == nil {
+			return nil, errors.New("There's no default rotation - set one with rotation default <name>")
+		}
+		return s.Default(), nil
+	}
+	r, ok := s.Rotations[cc.rotation]
+	if !ok {
+		return nil, fmt.Errorf("I don't know of a rotation named %v", cc.rotation)
+	}
+	return r, nil
+}
+
+func (s *State) AddRotation(name string) error {
+	if _, ok := s.Rotations[name]; ok {
+		return errors.New("We already have a rotation named " + name)
+	}
+	offset := time.Wednesday
+	if s.Default() != nil {
+		offset = s.Default().Offset
+	}
+	s.Rotations[name] = NewRotation(name, offset)
+	s.rotationChanged(name)
+	if s.Default() == nil {
+		s.DefaultRotation = name
+		s.otherChanged()
+	}
+	return nil
+}
+
+func (s *State) RemoveRotation(name string) error {
+	if _, ok := s.Rotations[name]; !ok {
+		return errors.New("I don't know of a rotation named " + name)
+	}
+	delete(s.Rotations, name)
+	s.rotationChanged(name)
+	if s.DefaultRotation == name {
+		s.DefaultRotation = ""
+		s.otherChanged()
+	}
+	s.removeUnrostered()
+	return nil
+}
+
+// AddMember adds the named person to r, and to the state if they're new.
+func (s *State) AddMember(r *Rotation, name string, ordering int) error {
+	if _, ok := r.Members[name]; ok {
+		return errors.New("We already have a " + name + " please choose a different name")
+	}
+	if _, ok := s.People[name]; !ok {
+		s.People[name] = NewPerson(name)
+		s.personChanged(name)
+	}
+	r.Members[name] = &Member{Name: name, OrderNum: ordering}
+	s.rotationChanged(r.Name)
+	return nil
+}
+
+// RemoveMember takes the named person out of r, and out of the state
+// entirely if they aren't in any other rotation.
+func (s *State) RemoveMember(r *Rotation, name string) error {
+	if _, ok := r.Members[name]; !ok {
+		return errors.New("Could not find '" + name + "'")
+	}
+	delete(r.Members, name)
+	s.rotationChanged(r.Name)
+	s.removeUnrostered()
+	return nil
+}
+
+// removeUnrostered forgets about anyone who isn't in any rotation.
+func (s *State) removeUnrostered() {
+	for name := range s.People {
+		rostered := false
+		for _, r := range s.Rotations {
+			if _, ok := r.Members[name]; ok {
+				rostered = true
+				break
+			}
+		}
+		if !rostered {
+			delete(s.People, name)
+			s.personChanged(name)
+		}
+	}
+}
+
+// RotationNames returns the names of all the rotations, sorted.
+func (s *State) RotationNames() []string {
+	names := make([]string, 0, len(s.Rotations))
+	for name := range s.Rotations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// legacyState is the part of State that was saved before there were
+// rotations, when the state had exactly one list of people and schedule.
+type legacyState struct {
+	People         map[string]*Person
+	Offset         time.Weekday
+	Cadence        Cadence
+	Schedule       *Schedule
+	Channel        string
+	ReminderLeads  []time.Duration
+	CommittedUntil time.Time
+}
+
+// migrate puts everything from a state saved before there were rotations
+// into the default rotation.
+func (s *State) migrate(old legacyState) {
+	r := NewRotation(DEFAULT_ROTATION, old.Offset)
+	r.Cadence = old.Cadence
+	r.Schedule = old.Schedule
+	r.Channel = old.Channel
+	r.ReminderLeads = old.ReminderLeads
+	r.CommittedUntil = old.CommittedUntil
+	for name, p := range old.People {
+		r.Members[name] = &Member{Name: name, PriorityNum: p.PriorityNum, OrderNum: p.OrderNum}
+	}
+	s.Rotations = map[string]*Rotation{r.Name: r}
+	s.DefaultRotation = r.Name
+}
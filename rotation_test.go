@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotations(t *testing.T) {
+	s := NewState(time.Wednesday)
+	if rotationCmd(command{action: "rotation", args: []string{"add", "list"}}, s) != "list is a command, please choose a different name" {
+		t.Fatalf("Shouldn't be able to name a rotation after a command")
+	}
+	rotationCmd(command{action: "rotation", args: []string{"add", "oncall-db"}}, s)
+	if len(s.Rotations) != 2 || s.DefaultRotation != DEFAULT_ROTATION {
+		t.Fatalf("Expected a new rotation alongside the default, got: %v", s.RotationNames())
+	}
+
+	db := command{action: "add", rotation: "oncall-db"}
+	db.args = []string{"joe"}
+	addPerson(db, s)
+	db.args = []string{"sue"}
+	addPerson(db, s)
+	addPerson(command{action: "add", args: []string{"joe"}}, s)
+	addPerson(command{action: "add", args: []string{"bob"}}, s)
+
+	if len(s.People) != 3 {
+		t.Fatalf("Expected joe, bob and sue, got: %v", s.People)
+	}
+	if list(command{action: "list", rotation: "oncall-db"}, s) != "joe, sue" {
+		t.Fatalf("oncall-db should have joe and sue")
+	}
+	if list(command{action: "list"}, s) != "bob, joe" {
+		t.Fatalf("support should have bob and joe")
+	}
+	if list(command{action: "list", rotation: "blah"}, s) != "I don't know of a rotation named blah" {
+		t.Fatalf("blah isn't a rotation")
+	}
+
+	// each rotation has its own schedule and cadence
+	cadenceCmd(command{action: "cadence", args: []string{"daily", "10:00"}, rotation: "oncall-db"}, s)
+	loc, _ := time.LoadLocation("America/Chicago")
+	at := time.Date(2015, time.October, 11, 22, 3, 0, 0, loc)
+	buildSchedule(command{action: "build", at: at, rotation: "oncall-db"}, s)
+	if s.Default().Schedule != nil {
+		t.Fatalf("Building oncall-db shouldn't build support")
+	}
+	for _, shift := range s.Rotations["oncall-db"].Schedule.ShiftsList {
+		if shift.Worker().Identifier() == "bob" {
+			t.Fatalf("bob isn't in oncall-db")
+		}
+		if shift.End().Sub(shift.Start()) > time.Hour*25 {
+			t.Fatalf("oncall-db shifts should be daily: %v", shift)
+		}
+	}
+
+	// joe is still in support after leaving oncall-db, sue is gone entirely
+	removePerson(command{action: "remove", args: []string{"joe"}, rotation: "oncall-db"}, s)
+	removePerson(command{action: "remove", args: []string{"sue"}, rotation: "oncall-db"}, s)
+	if s.People["joe"] == nil || s.People["sue"] != nil {
+		t.Fatalf("Expected joe and bob to remain, got: %v", s.People)
+	}
+
+	rotationCmd(command{action: "rotation", args: []string{"default", "oncall-db"}}, s)
+	rotationCmd(command{action: "rotation", args: []string{"remove", "oncall-db"}}, s)
+	if s.Default() != nil {
+		t.Fatalf("Removing the default rotation should leave no default")
+	}
+	if list(command{action: "list"}, s) != "There's no default rotation - set one with rotation default <name>" {
+		t.Fatalf("Commands should complain when there is no default rotation")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	loc := inChicago(t)
+	start := time.Date(2015, time.October, 11, 22, 0, 0, 0, loc)
+	end := time.Date(2015, time.November, 18, 17, 0, 0, 0, loc)
+
+	old := NewState(time.Monday)
+	old.AddPerson("joe", 2)
+	old.Default().Members["joe"].PriorityNum = 5
+	sched := old.BuildSchedule(start, end)
+
+	// a state file from before there were rotations
+	filename := filepath.Join(t.TempDir(), "skedState.gob")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatalf("Couldn't create state file: %v", err)
+	}
+	joe := NewPerson("joe")
+	joe.PriorityNum = 5
+	joe.OrderNum = 2
+	err = gob.NewEncoder(f).Encode(legacyState{
+		People:   map[string]*Person{"joe": joe},
+		Offset:   time.Monday,
+		Schedule: sched,
+		Channel:  "C123",
+	})
+	f.Close()
+	if err != nil {
+		t.Fatalf("Couldn't write state file: %v", err)
+	}
+
+	s := NewState(time.Wednesday)
+	s.StorageID = filename
+	err = s.Populate()
+	if err != nil {
+		t.Fatalf("Couldn't populate: %v", err)
+	}
+	r := s.Default()
+	if len(s.Rotations) != 1 || r == nil || r.Name != DEFAULT_ROTATION {
+		t.Fatalf("Expected just the default rotation, got: %v", s.RotationNames())
+	}
+	if r.Offset != time.Monday || r.Channel != "C123" || r.Schedule.String() != sched.String() {
+		t.Fatalf("Rotation wasn't migrated properly: %v", r)
+	}
+	if m := r.Members["joe"]; m == nil || m.PriorityNum != 5 || m.OrderNum != 2 || s.People["joe"] == nil {
+		t.Fatalf("joe wasn't migrated properly: %v", m)
+	}
+}
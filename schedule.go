@@ -9,13 +9,16 @@ import (
 
 const MAX_WEEKS = 10
 
+// How times are shown to people
+const TIME_FORMAT = "Mon Jan 2 15:04 MST"
+
 type Schedule struct {
 	ShiftsList []*Shift
 	shiftIdx   int
 }
 
-func NewSchedule(start time.Time, end time.Time, offset time.Weekday) *Schedule {
-	return &Schedule{ShiftsList: GetWeeklyShifts(start, end, offset)}
+func NewSchedule(start time.Time, end time.Time, gen ShiftGenerator) *Schedule {
+	return &Schedule{ShiftsList: gen.Shifts(start, end)}
 }
 
 func (sched *Schedule) Current() (*Person, error) {
@@ -32,10 +35,24 @@ func (sched *Schedule) GetShift(t time.Time) (*Shift, error) {
 			return shift, nil
 		}
 	}
+	if sched.NumShifts() == 0 {
+		return nil, errors.New("The schedule is empty")
+	}
 	return nil, errors.New(fmt.Sprintf("Time %v is not in the schedule which goes from %v to %v",
 		t, sched.ShiftsList[0].Start(), sched.ShiftsList[sched.NumShifts()-1].End()))
 }
 
+// GetShifts returns every shift which overlaps i, in order.
+func (sched *Schedule) GetShifts(i Intervaler) []*Shift {
+	shifts := []*Shift{}
+	for _, shift := range sched.ShiftsList {
+		if shift.Overlaps(i) {
+			shifts = append(shifts, shift)
+		}
+	}
+	return shifts
+}
+
 func (sched *Schedule) String() string {
 	sched_strings := make([]string, len(sched.ShiftsList))
 	for i, t := range sched.ShiftsList {
@@ -45,6 +62,15 @@ func (sched *Schedule) String() string {
 
 }
 
+// Format describes the schedule for people, with times in loc.
+func (sched *Schedule) Format(loc *time.Location) string {
+	lines := make([]string, len(sched.ShiftsList))
+	for i, shift := range sched.ShiftsList {
+		lines[i] = shift.Format(loc)
+	}
+	return strings.Join(lines, "\n")
+}
+
 func (sched *Schedule) Next() (Shifter, error) {
 	if sched.shiftIdx < len(sched.ShiftsList) {
 		sched.shiftIdx += 1
@@ -56,11 +82,19 @@ func (sched *Schedule) Next() (Shifter, error) {
 }
 
 func (sched *Schedule) AddShift(p *Person, start time.Time, end time.Time) {
+	sched.ReplaceShift(p, start, end, EDITED)
+}
+
+// ReplaceShift puts p on from start to end, shortening, splitting or
+// removing whichever shifts were there, and marks the new shift with
+// change.
+func (sched *Schedule) ReplaceShift(p *Person, start time.Time, end time.Time, change string) {
 	newShift, err := NewShift(start, end)
 	if err != nil {
 		panic(err)
 	}
 	newShift.SetWorker(p)
+	newShift.Change = change
 	var i int
 	var s *Shift
 	for i, s = range sched.ShiftsList {
@@ -78,7 +112,7 @@ func (sched *Schedule) AddShift(p *Person, start time.Time, end time.Time) {
 			return
 		} else if overlap == EndsLater || overlap == Subsumes {
 			sched.ShiftsList = append(sched.ShiftsList[:i], sched.ShiftsList[i+1:]...)
-			sched.AddShift(p, start, end)
+			sched.ReplaceShift(p, start, end, change)
 			return
 		} else if overlap == Interior {
 			ns, err := NewShift(newShift.End(), s.End())
@@ -86,12 +120,14 @@ func (sched *Schedule) AddShift(p *Person, start time.Time, end time.Time) {
 				panic(err)
 			}
 			ns.SetWorker(s.Worker())
+			ns.Change = s.Change
 			s.SetEnd(newShift.Start())
 			sched.ShiftsList = append(sched.ShiftsList[:i+1],
 				append([]*Shift{newShift, ns}, sched.ShiftsList[i+1:]...)...)
 			return
 		} else if overlap == Same {
 			s.SetWorker(p)
+			s.Change = change
 			return
 		} else if overlap == Suffix {
 			s.SetEnd(newShift.Start())
@@ -99,19 +135,30 @@ func (sched *Schedule) AddShift(p *Person, start time.Time, end time.Time) {
 			return
 		} else if overlap == OverlapsEnd {
 			s.SetEnd(newShift.Start())
-			sched.AddShift(p, start, end)
+			sched.ReplaceShift(p, start, end, change)
 			return
 		}
 	}
 
 }
 
+// trimBefore drops the part of the schedule before t.
+func (sched *Schedule) trimBefore(t time.Time) {
+	for len(sched.ShiftsList) > 0 && !sched.ShiftsList[0].End().After(t) {
+		sched.ShiftsList = sched.ShiftsList[1:]
+	}
+	if len(sched.ShiftsList) > 0 && sched.ShiftsList[0].Start().Before(t) {
+		sched.ShiftsList[0].SetStart(t)
+	}
+}
+
 func (sched *Schedule) NumShifts() int {
 	return len(sched.ShiftsList)
 }
 
-func (s *Schedule) SPrintCalendar() string {
-	startShifts := s.ShiftsList[0].Start()
+// SPrintCalendar lays the schedule out on a calendar of the days in loc.
+func (s *Schedule) SPrintCalendar(loc *time.Location) string {
+	startShifts := s.ShiftsList[0].Start().In(loc)
 	start := getLastWeekday(startShifts, time.Sunday)
 
 	line := "| Sunday    | Monday    | Tuesday   | Wednesday | Thursday  | Friday    | Saturday  |\n"
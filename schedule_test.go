@@ -10,7 +10,7 @@ func TestNext(t *testing.T) {
 	start := time.Date(2015, time.October, 10, 0, 0, 0, 0, loc)
 	end := time.Date(2015, time.October, 18, 0, 0, 0, 0, loc)
 
-	sched := NewSchedule(start, end, time.Wednesday)
+	sched := NewSchedule(start, end, WeeklyCadence(time.Wednesday))
 
 	numShifts := sched.NumShifts()
 
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A server serves sked over HTTP, for dashboards and other tools. Anyone
+// can read, but running commands needs the token.
+//
+//	GET  /people                     everyone, and the rotations they're in
+//	GET  /schedule?rotation=         the rotation's schedule
+//	GET  /current?rotation=          the shift happening now
+//	GET  /shift?at=<date>&rotation=  the shift at a date, see parseDate
+//	GET  /calendar.ics?rotation=&person=
+//	POST /commands/<action>          {"args": [...], "rotation": "", "user": ""}
+//
+// rotation is the default rotation if it's left out.
+type server struct {
+	state      *State
+	commandMap map[string]action
+	audit      *AuditLog
+	// Needed as a bearer token to run commands, which can't be run at all
+	// if it's ""
+	token string
+}
+
+func newServer(state *State, commandMap map[string]action, audit *AuditLog, token string) http.Handler {
+	sv := &server{state: state, commandMap: commandMap, audit: audit, token: token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/people", sv.get(sv.people))
+	mux.HandleFunc("/schedule", sv.get(sv.schedule))
+	mux.HandleFunc("/current", sv.get(sv.current))
+	mux.HandleFunc("/shift", sv.get(sv.shift))
+	mux.HandleFunc("/calendar.ics", sv.calendar)
+	mux.HandleFunc("/commands/", sv.command)
+	return mux
+}
+
+// serveHTTP serves sked on addr until it fails.
+func serveHTTP(addr string, state *State, commandMap map[string]action, audit *AuditLog, token string) {
+	if token == "" {
+		log.Printf("No HTTP token was given, so commands can't be run over HTTP")
+	}
+	log.Printf("Serving HTTP on %v", addr)
+	log.Fatal(http.ListenAndServe(addr, newServer(state, commandMap, audit, token)))
+}
+
+// An httpError is an error with the status to respond with.
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e httpError) Error() string {
+	return e.msg
+}
+
+type personJSON struct {
+	Name      string   `json:"name"`
+	SlackID   string   `json:"slack_id,omitempty"`
+	TZ        string   `json:"tz,omitempty"`
+	Rotations []string `json:"rotations"`
+}
+
+type shiftJSON struct {
+	Worker   string    `json:"worker"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Change   string    `json:"change,omitempty"`
+	Holidays []string  `json:"holidays,omitempty"`
+}
+
+type commandJSON struct {
+	Args     []string `json:"args"`
+	Rotation string   `json:"rotation"`
+	// Slack ID of whoever the command is on behalf of, for their time zone
+	// and the audit log
+	User string `json:"user"`
+}
+
+type responseJSON struct {
+	Response string `json:"response"`
+	Changed  bool   `json:"changed"`
+}
+
+// get wraps a handler for a read endpoint, which is run with the state
+// locked and whose result is written out as JSON.
+func (sv *server) get(handler func(*http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			writeError(w, httpError{http.StatusMethodNotAllowed, "Only GET is allowed"})
+			return
+		}
+		sv.state.Lock()
+		v, err := handler(req)
+		sv.state.Unlock()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+	}
+}
+
+func (sv *server) people(req *http.Request) (interface{}, error) {
+	names := make([]string, 0, len(sv.state.People))
+	for name := range sv.state.People {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	people := make([]personJSON, len(names))
+	for i, name := range names {
+		p := sv.state.People[name]
+		people[i] = personJSON{Name: p.Name, SlackID: p.SlackID, TZ: p.TZ, Rotations: []string{}}
+		for _, rotation := range sv.state.RotationNames() {
+			if _, ok := sv.state.Rotations[rotation].Members[name]; ok {
+				people[i].Rotations = append(people[i].Rotations, rotation)
+			}
+		}
+	}
+	return people, nil
+}
+
+func (sv *server) schedule(req *http.Request) (interface{}, error) {
+	r, err := sv.rotation(req)
+	if err != nil {
+		return nil, err
+	}
+	shifts := []shiftJSON{}
+	if r.Schedule != nil {
+		for _, shift := range r.Schedule.ShiftsList {
+			shifts = append(shifts, sv.shiftJSON(shift))
+		}
+	}
+	return shifts, nil
+}
+
+func (sv *server) current(req *http.Request) (interface{}, error) {
+	return sv.shiftAt(req, time.Now())
+}
+
+func (sv *server) shift(req *http.Request) (interface{}, error) {
+	at := req.URL.Query().Get("at")
+	if at == "" {
+		return nil, httpError{http.StatusBadRequest, "Say when with ?at=<date>"}
+	}
+	args := strings.Fields(at)
+	date, _, n, err := parseDate(args, time.Now())
+	if err == nil && n < len(args) {
+		err = dateError(args)
+	}
+	if err != nil {
+		return nil, httpError{http.StatusBadRequest, err.Error()}
+	}
+	return sv.shiftAt(req, date)
+}
+
+func (sv *server) shiftAt(req *http.Request, t time.Time) (interface{}, error) {
+	r, err := sv.rotation(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.Schedule == nil {
+		return nil, httpError{http.StatusNotFound, fmt.Sprintf("%v has no schedule, build one first", r.Name)}
+	}
+	shift, err := r.Schedule.GetShift(t)
+	if err != nil {
+		return nil, httpError{http.StatusNotFound, err.Error()}
+	}
+	return sv.shiftJSON(shift), nil
+}
+
+func (sv *server) shiftJSON(shift *Shift) shiftJSON {
+	js := shiftJSON{
+		Worker: shift.Worker().Identifier(),
+		Start:  shift.Start(),
+		End:    shift.End(),
+		Change: shift.Change,
+	}
+	for _, h := range sv.state.holidaysDuring(shift) {
+		js.Holidays = append(js.Holidays, h.String())
+	}
+	return js
+}
+
+// rotation returns the rotation named in req, or the default one.
+func (sv *server) rotation(req *http.Request) (*Rotation, error) {
+	r, err := sv.state.rotation(command{rotation: req.URL.Query().Get("rotation")})
+	if err != nil {
+		return nil, httpError{http.StatusNotFound, err.Error()}
+	}
+	return r, nil
+}
+
+// calendar serves the schedule as an iCalendar feed, which calendar apps
+// can subscribe to.
+func (sv *server) calendar(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		writeError(w, httpError{http.StatusMethodNotAllowed, "Only GET is allowed"})
+		return
+	}
+	rotations := []string{}
+	if rotation := req.URL.Query().Get("rotation"); rotation != "" {
+		rotations = append(rotations, rotation)
+	}
+	person := req.URL.Query().Get("person")
+	sv.state.Lock()
+	_, ok := sv.state.People[person]
+	ics, err := sv.state.ICS(rotations, person, time.Now())
+	sv.state.Unlock()
+	if person != "" && !ok {
+		err = httpError{http.StatusNotFound, fmt.Sprintf("There's no one called %v", person)}
+	} else if err != nil {
+		err = httpError{http.StatusNotFound, err.Error()}
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write([]byte(ics))
+}
+
+// command runs one of the commands in commandMap, the same as if it had
+// been sent in Slack, and responds with what sked said.
+func (sv *server) command(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, httpError{http.StatusMethodNotAllowed, "Only POST is allowed"})
+		return
+	}
+	if !sv.authorized(req) {
+		writeError(w, httpError{http.StatusUnauthorized, "Running commands needs a valid token"})
+		return
+	}
+	name := strings.TrimPrefix(req.URL.Path, "/commands/")
+	act, ok := sv.commandMap[name]
+	if !ok {
+		writeError(w, httpError{http.StatusNotFound, fmt.Sprintf("There's no command called %v", name)})
+		return
+	}
+	body := commandJSON{}
+	if req.ContentLength != 0 {
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeError(w, httpError{http.StatusBadRequest, fmt.Sprintf("Couldn't read the command: %v", err)})
+			return
+		}
+	}
+	if body.Args == nil {
+		body.Args = []string{}
+	}
+	c := command{
+		action:   name,
+		args:     body.Args,
+		user:     body.User,
+		at:       time.Now(),
+		rotation: body.Rotation,
+	}
+	msg, changed, err := execute(act, c, sv.state, sv.audit)
+	if err != nil {
+		writeError(w, httpError{http.StatusInternalServerError, fmt.Sprintf("I'm having trouble persisting my state - err: %v", err)})
+		return
+	}
+	writeJSON(w, http.StatusOK, responseJSON{Response: msg, Changed: changed})
+}
+
+func (sv *server) authorized(req *http.Request) bool {
+	if sv.token == "" {
+		return false
+	}
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(sv.token)) == 1
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Problem writing an HTTP response, err: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if he, ok := err.(httpError); ok {
+		status = he.status
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
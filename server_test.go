@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	auditLog, err := OpenAuditLog(filepath.Join(dir, "sked-log.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLog.Close()
+	s := NewState(time.Wednesday)
+	s.StorageID = filepath.Join(dir, "skedState.json")
+	ts := httptest.NewServer(newServer(s, newCommandMap(), auditLog, "secret"))
+	defer ts.Close()
+
+	post := func(action string, body string, token string) (int, responseJSON) {
+		req, _ := http.NewRequest("POST", ts.URL+"/commands/"+action, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		out := responseJSON{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+	get := func(path string, v interface{}) int {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if v != nil {
+			json.NewDecoder(resp.Body).Decode(v)
+		}
+		return resp.StatusCode
+	}
+
+	if status, _ := post("add", `{"args": ["joe"]}`, ""); status != http.StatusUnauthorized {
+		t.Fatalf("Commands shouldn't run without the token, got %v", status)
+	}
+	if status, _ := post("add", `{"args": ["joe"]}`, "wrong"); status != http.StatusUnauthorized {
+		t.Fatalf("Commands shouldn't run with the wrong token, got %v", status)
+	}
+	if status, _ := post("nope", `{}`, "secret"); status != http.StatusNotFound {
+		t.Fatalf("There's no command called nope, got %v", status)
+	}
+	for _, name := range []string{"joe", "bob"} {
+		status, resp := post("add", `{"args": ["`+name+`"]}`, "secret")
+		if status != http.StatusOK || !resp.Changed {
+			t.Fatalf("Couldn't add %v: %v %v", name, status, resp)
+		}
+	}
+	if status, resp := post("build", "", "secret"); status != http.StatusOK || !strings.HasPrefix(resp.Response, "```") {
+		t.Fatalf("Couldn't build: %v %v", status, resp)
+	}
+	if _, err := os.Stat(s.StorageID); err != nil {
+		t.Fatalf("The state should have been persisted: %v", err)
+	}
+	if entries, _ := auditLog.Recent(10); len(entries) != 3 || entries[0].Action != "add" {
+		t.Fatalf("The commands should have been audited: %v", entries)
+	}
+
+	// a command without its arguments mustn't leave the state locked
+	if status, resp := post("add", `{}`, "secret"); status != http.StatusOK || resp.Changed || resp.Response != "add <name> [ordering_num]" {
+		t.Fatalf("add needs a name: %v %v", status, resp)
+	}
+	people := []personJSON{}
+	if status := get("/people", &people); status != http.StatusOK || len(people) != 2 ||
+		people[0].Name != "bob" || people[0].Rotations[0] != DEFAULT_ROTATION {
+		t.Fatalf("Unexpected people: %v %v", status, people)
+	}
+	shifts := []shiftJSON{}
+	if status := get("/schedule", &shifts); status != http.StatusOK || len(shifts) != s.Default().Schedule.NumShifts() {
+		t.Fatalf("Unexpected schedule: %v %v", status, shifts)
+	}
+	current := shiftJSON{}
+	if status := get("/current", &current); status != http.StatusOK || !current.Start.Equal(shifts[0].Start) {
+		t.Fatalf("Unexpected current shift: %v %v", status, current)
+	}
+	shift := shiftJSON{}
+	next := shifts[1].Start.Add(time.Hour).Format("2006-01-02T15:04")
+	if status := get("/shift?at="+next, &shift); status != http.StatusOK || shift.Worker != shifts[1].Worker {
+		t.Fatalf("Unexpected shift at %v: %v %v", next, status, shift)
+	}
+	if status := get("/shift?at=blah", nil); status != http.StatusBadRequest {
+		t.Fatalf("blah isn't a date, got %v", status)
+	}
+	if status := get("/schedule?rotation=nope", nil); status != http.StatusNotFound {
+		t.Fatalf("There's no rotation called nope, got %v", status)
+	}
+
+	resp, err := http.Get(ts.URL + "/calendar.ics?person=joe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.Header.Get("Content-Type") != "text/calendar; charset=utf-8" || !strings.Contains(string(body), "SUMMARY:joe on support") ||
+		strings.Contains(string(body), "bob on") {
+		t.Fatalf("Unexpected calendar for joe:\n%s", body)
+	}
+	if status := get("/calendar.ics?person=nope", nil); status != http.StatusNotFound {
+		t.Fatalf("There's no one called nope, got %v", status)
+	}
+}
@@ -6,6 +6,17 @@ import (
 	"time"
 )
 
+// Who works a shift that no one has been assigned to
+const EMPTY_WORKER = "EMPTY!"
+
+// How a shift came to differ from the schedule that was built
+const (
+	UNCHANGED = ""
+	EDITED    = "edited"
+	SWAPPED   = "swapped"
+	COVERED   = "covered"
+)
+
 type Overlap int
 
 const (
@@ -150,6 +161,8 @@ func (i *Interval) GetOverlap(i2 Intervaler) Overlap {
 type Shift struct {
 	*Interval
 	WorkerThing *Person
+	// UNCHANGED unless the shift was changed after the schedule was built
+	Change string
 }
 
 // Create a new Shift that goes from start to end.
@@ -160,15 +173,28 @@ func NewShift(start time.Time, end time.Time) (*Shift, error) {
 	}
 	ns := Shift{
 		Interval:    interval,
-		WorkerThing: NewPerson("EMPTY!"),
+		WorkerThing: NewPerson(EMPTY_WORKER),
 	}
 	return &ns, nil
 }
 
 func (s *Shift) String() string {
+	if s.Change != UNCHANGED {
+		return fmt.Sprintf("%v from %v to %v (%v)", s.Worker().Identifier(), s.Start(), s.End(), s.Change)
+	}
 	return fmt.Sprintf("%v from %v to %v", s.Worker().Identifier(), s.Start(), s.End())
 }
 
+// Format describes the shift for people, with times in loc.
+func (s *Shift) Format(loc *time.Location) string {
+	str := fmt.Sprintf("%v from %v to %v", s.Worker().Identifier(),
+		s.Start().In(loc).Format(TIME_FORMAT), s.End().In(loc).Format(TIME_FORMAT))
+	if s.Change != UNCHANGED {
+		str += fmt.Sprintf(" (%v)", s.Change)
+	}
+	return str
+}
+
 func (s *Shift) Worker() *Person {
 	return s.WorkerThing
 }
@@ -178,20 +204,7 @@ func (s *Shift) SetWorker(w *Person) {
 }
 
 func GetWeeklyShifts(start time.Time, until time.Time, offset time.Weekday) []*Shift {
-	lwd := getLastWeekday(start, offset)
-	num_shifts := int((until.Sub(lwd).Hours()/24.0)/7.0) + 1
-	shifts := make([]*Shift, num_shifts)
-	cur := lwd
-	for i := 0; i < num_shifts; i++ {
-		startTime := cur
-		cur = atMidnight(cur.Add(time.Hour * ((24 * 7) + 2)))
-		ashift, err := NewShift(startTime, cur)
-		if err != nil {
-			panic(err)
-		}
-		shifts[i] = ashift
-	}
-	return shifts
+	return WeeklyCadence(offset).Shifts(start, until)
 }
 
 func atMidnight(t time.Time) time.Time {
@@ -133,7 +133,7 @@ func TestWorkers(t *testing.T) {
 }
 
 func TestGetWeeklyShifts(t *testing.T) {
-	loc, _ := time.LoadLocation("America/Chicago")
+	loc := inChicago(t)
 	start := time.Date(2015, time.October, 11, 22, 3, 0, 0, loc)
 	until := time.Date(2015, time.November, 5, 14, 1, 0, 0, loc)
 	shifts := GetWeeklyShifts(start, until, time.Wednesday)
@@ -28,19 +28,34 @@ THE SOFTWARE.
 package main
 
 import (
-	"bufio"
 	"encoding/gob"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"runtime/debug"
 	"strconv"
 	"strings"
 	"time"
 )
 
 type command struct {
-	action string
-	args   []string
+	action  string
+	args    []string
+	channel string
+	// Slack ID of whoever issued the command
+	user string
+	// When the command was issued - zero means now
+	at time.Time
+	// The rotation the command was addressed to - "" means the default
+	rotation string
+}
+
+func (cc command) now() time.Time {
+	if cc.at.IsZero() {
+		return time.Now()
+	}
+	return cc.at
 }
 
 type action struct {
@@ -48,75 +63,162 @@ type action struct {
 	help     string
 }
 
-func writeHandler(logChan chan string, w *bufio.Writer) {
-	for {
-		s := <-logChan + "\n"
-		fmt.Println("Writing", s, []byte(s))
-		n, err := w.Write([]byte(s))
-		fmt.Println(n, "bytes written")
-		if err != nil {
-			log.Printf("Problem while writing, err:%v", err)
-			panic(err)
-		}
-	}
-}
-
-func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: sked <slack-bot-token> [state-file]\n")
-		os.Exit(1)
-	}
-	gob.Register(Interval{})
-	gob.Register(Shift{})
-
-	token := os.Args[1]
-	// set up state
-	// TODO rename all command funcs to <name>Cmd
-	commandMap := map[string]action{
+// TODO rename all command funcs to <name>Cmd
+func newCommandMap() map[string]action {
+	return map[string]action{
 		"current":  action{getCurrent, "Tell me who's scheduled right now"},
+		"who":      action{whoCmd, "Tell me who's scheduled at a time. who [<date> [to <date>]] or who this week|next week. Dates can be " + DATE_FORMATS},
 		"add":      action{addPerson, "Add a new person to be scheduled. add <name> [ordering_num]"},
 		"remove":   action{removePerson, "Remove a person from scheduling. remove <name>"},
 		"list":     action{list, "List all the possible people that could be scheduled"},
-		"unavail":  action{addUnavailable, "unavail <name> <[YYYY]MMDD[HH]> [to [YYYY]MMDD[HH]]"},
+		"unavail":  action{addUnavailable, "unavail <name> <date> [to <date>] or unavail <name> every [2nd|last] <day|weekday|weekend|friday ...> [<time> to <time>] e.g. unavail bob every friday. unavail list <name> shows someone's unavailability and unavail remove <name> <id> drops one"},
+		"prefer":   action{preferCmd, "Say when someone would rather or would rather not work, which build will go against only if it has to. prefer <name> [not] <date> [to <date>], prefer list <name> or prefer remove <name> <id>"},
 		"schedule": action{getSchedule, "Get the schedule which has been previously built. Or build and return it if it hasn't been built."},
 		"build":    action{buildSchedule, "(Re)Build the schedule using the people and availabilities given so far"},
-		"edit":     action{editScheduleCmd, "edit <name> [YYYY]<MMDD>[HH] to [YYYY]<MMDD>[HH]"},
+		"edit":     action{editScheduleCmd, "edit <name> <date> to <date>"},
+		"swap":     action{swapCmd, "Trade shifts. swap <name> <name> <date> [<date>] swaps the first person's shift then for the second person's shift at the second date, or their next one"},
+		"cover":    action{coverCmd, "Have someone take over part of the schedule. cover <name> <date> to <date>"},
 		"printCal": action{printCal, "Print in Calendar format (experimental)"},
+		"cadence":  action{cadenceCmd, "How often shifts change hands. cadence [daily|weekly|biweekly|<n>d|<n>w] [weekday] [HH:MM] [skip-holidays] e.g. cadence biweekly wed 10:00. skip-holidays moves handoffs to the next day which isn't a holiday"},
+		"rest":     action{restCmd, "How many shifts people get off between shifts, unless no one else can work. rest [n]"},
+		"strategy": action{strategyCmd, "How build decides whose turn it is. strategy [priority|round-robin|least-hours|random [seed]]"},
+		"solver":   action{solverCmd, "Have build search the whole schedule for the fewest empty shifts, then the fewest shifts worked without a rest, then the most even load counting the hours already worked, then the fewest preferences gone against, for up to a time limit of at most 1m. solver [on [limit]|off] e.g. solver on 5s"},
+		"holiday":  action{holidayCmd, "Days which count for more when working out whose turn it is. holiday [list|add <date> [name]|remove <date>|import <file>]. import reads an iCalendar (.ics), CSV (date,name) or YAML (- date: name) file from the directory sked was started with -holidays"},
+		"weights":  action{weightsCmd, "How much more an hour on a weekend or holiday counts. weights [weekend <n>] [holiday <n>] e.g. weights holiday 3"},
+		"history":  action{historyCmd, "Who worked when, with totals. history [name] [since date]"},
+		"start":    action{startScheduling, "Announce shift handoffs in a channel. start [#channel]"},
+		"remind":   action{remindCmd, "Remind people before their shifts start. remind [<lead> ...|off] e.g. remind 24h 1h"},
+		"tz":       action{tzCmd, "Set the time zone someone's dates are read and shown in. tz <name> [<zone>|off] e.g. tz bob America/Chicago"},
+		"contact":  action{contactCmd, "Tell me who to send someone's reminders to. contact <name> <@user>"},
+		"rotation": action{rotationCmd, "Manage rotations. rotation [list|add <name>|remove <name>|default <name>]. Address any command to a rotation with <rotation> <command> ..."},
+		"audit":    action{auditCmd, "Show the most recent commands, who issued them and what happened. audit [n]"},
 	}
-	skedState := NewState(time.Wednesday)
-	err := skedState.Populate()
-	if err != nil {
-		log.Printf("Error populating from %v. err: %v.", skedState.StorageID, err)
+}
+
+func main() {
+	gob.Register(Interval{})
+	gob.Register(&Unavailable{})
+	gob.Register(Shift{})
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			exportMain(os.Args[2:])
+			return
+		case "cli":
+			cliMain(os.Args[2:])
+			return
+		case "repl":
+			replMain(os.Args[2:])
+			return
+		}
 	}
 
+	replay := flag.Bool("replay", false, "rebuild the state by replaying the command log instead of loading the state snapshot")
+	db := flag.String("db", "", "keep the state in a bbolt database at this path instead of "+DEFAULT_STORAGE_ID)
+	httpAddr := flag.String("http", "", "also serve the JSON API and calendar feed on this address, e.g. :8080")
+	httpToken := flag.String("http-token", os.Getenv("SKED_HTTP_TOKEN"), "the bearer token needed to run commands over HTTP, defaults to $SKED_HTTP_TOKEN")
+	flag.StringVar(&holidayDir, "holidays", "", "the directory holiday import reads files from, import is turned off if empty")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sked [-replay] [-db path] [-http addr] [-http-token token] [-holidays dir] <slack-bot-token> [log-file]\n")
+		fmt.Fprintf(os.Stderr, "       sked export [-replay] [-db path] [-rotation name] [-person name] [-o file] [log-file]\n")
+		fmt.Fprintf(os.Stderr, "       sked cli [-replay] [-db path] [-log file] [-user id] [-holidays dir] [rotation] <command> [args...]\n")
+		fmt.Fprintf(os.Stderr, "       sked repl [-replay] [-db path] [-log file] [-user id] [-holidays dir]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	token := flag.Arg(0)
+	commandMap := newCommandMap()
+
 	// Output file handling
 	var filename string
-	var stateFile *os.File
-	if len(os.Args) >= 3 {
-		filename = os.Args[2]
+	if flag.NArg() >= 2 {
+		filename = flag.Arg(1)
 	} else {
 		filename = "sked-log.txt"
 	}
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		stateFile, err = os.Create(filename)
+
+	skedState := loadState(filename, *db, *replay, commandMap)
+	defer skedState.store().Close()
+
+	auditLog, err := OpenAuditLog(filename)
+	if err != nil {
+		log.Fatalf("Could not open file: %v, error: %v", filename, err)
+	}
+	defer auditLog.Close()
+	skedState.audit = auditLog
+
+	if *httpAddr != "" {
+		go serveHTTP(*httpAddr, skedState, commandMap, auditLog, *httpToken)
+	}
+	run(auditLog, token, commandMap, skedState)
+}
+
+// loadState loads the state from the bbolt database at db, or the state
+// snapshot if db is "", or replays the command log in filename if told to
+// or if neither has a usable state. A new database starts out with what's
+// in the snapshot, but a database which can't be read is fatal, so it
+// isn't saved over.
+func loadState(filename string, db string, replay bool, commandMap map[string]action) *State {
+	var store Store
+	if db != "" {
+		var err error
+		store, err = OpenBoltStore(db)
 		if err != nil {
-			log.Fatalf("Could not open file: %v, error: %v", filename, err)
+			log.Fatal(err)
+		}
+	}
+	skedState := NewState(time.Wednesday)
+	skedState.SetStore(store)
+	if replay {
+		var err error
+		skedState, err = replayFile(filename, commandMap)
+		if err != nil {
+			log.Fatalf("Could not replay %v, error: %v", filename, err)
+		}
+		skedState.SetStore(store)
+	} else if err := skedState.Populate(); err != nil {
+		if db != "" && err != errNothingSaved {
+			// starting over would save over whatever is in there
+			log.Fatalf("Could not load %v, error: %v", db, err)
+		}
+		log.Printf("Error populating from %v. err: %v.", storeName(skedState, db), err)
+		if db != "" {
+			if err = (fileStore{}).Load(skedState); err == nil {
+				return skedState
+			}
+			log.Printf("Error populating from %v. err: %v.", skedState.StorageID, err)
+		}
+		if _, err := os.Stat(filename); err == nil {
+			// recover from the command log instead
+			skedState, err = replayFile(filename, commandMap)
+			if err != nil {
+				log.Printf("Error replaying %v. err: %v.", filename, err)
+			}
+			skedState.SetStore(store)
 		}
-		defer stateFile.Close()
-	} else {
-		// read file line by line
-		// play commands
 	}
-	w := bufio.NewWriter(stateFile)
-	logChan := make(chan string)
-	go writeHandler(logChan, w)
+	return skedState
+}
 
-	run(logChan, token, commandMap, skedState)
+func storeName(s *State, db string) string {
+	if db != "" {
+		return db
+	}
+	return s.StorageID
 }
 
-func run(logChan chan string, token string, command_map map[string]action, skedState State) {
+func run(auditLog *AuditLog, token string, command_map map[string]action, skedState *State) {
 	// start a websocket-based Real Time API session
 	ws, id := slackConnect(token)
+	skedState.Lock()
+	skedState.notifier = slackNotifier{ws, token}
+	runSchedule(skedState)
+	skedState.Unlock()
 	log.Println("sked ready, ^C exits")
 
 	// main loop
@@ -133,34 +235,11 @@ func run(logChan chan string, token string, command_map map[string]action, skedS
 		// see if we're mentioned
 		if m.Type == "message" && strings.HasPrefix(m.Text, "<@"+id+">") {
 			parts := strings.Fields(m.Text)
-			// command name is first argument
-			var msg string
-			var com_name string
-			if len(parts) > 1 {
-				com_name = parts[1]
-			} else {
-				com_name = "help"
-			}
-
-			// 'help' is treated specially
-			if com_name == "help" {
-				msg = helpAction(command_map, parts)
-			} else if act, ok := command_map[com_name]; ok {
-				// if we know the command...
-				// write to command log
-				logChan <- strings.Join(parts[1:], " ")
-				c := command{parts[1], parts[2:]}
-				skedState.Lock()
-				msg = act.function(c, &skedState)
-				err := skedState.Persist()
-				skedState.Unlock()
-				if err != nil {
-					m.Text = fmt.Sprintf("I'm having trouble persisting my state - err: %v", err)
-					go postMessage(ws, m)
-				}
-			} else {
-				// we don't know the command
-				msg = fmt.Sprintln("sorry, that does not compute")
+			msg, err := runCommand(parts[1:], command{channel: m.Channel, user: m.User, at: time.Now()},
+				command_map, skedState, auditLog)
+			if err != nil {
+				m.Text = fmt.Sprintf("I'm having trouble persisting my state - err: %v", err)
+				go postMessage(ws, m)
 			}
 			m.Text = msg
 			go postMessage(ws, m)
@@ -168,6 +247,86 @@ func run(logChan chan string, token string, command_map map[string]action, skedS
 	}
 }
 
+// runCommand runs the command in words - its name and then its arguments,
+// optionally addressed to a rotation by starting with the rotation's name
+// - as issued by c's user in c's channel. It returns sked's response and
+// any error persisting the state.
+func runCommand(words []string, c command, command_map map[string]action, skedState *State, auditLog *AuditLog) (string, error) {
+	// command name is first argument, unless it names a rotation
+	if len(words) > 1 {
+		if _, ok := command_map[words[0]]; !ok {
+			skedState.Lock()
+			if _, ok := skedState.Rotations[words[0]]; ok {
+				c.rotation = words[0]
+				words = words[1:]
+			}
+			skedState.Unlock()
+		}
+	}
+	if len(words) == 0 {
+		words = []string{"help"}
+	}
+
+	// 'help' is treated specially
+	if words[0] == "help" {
+		return helpAction(command_map, append([]string{""}, words...)), nil
+	}
+	act, ok := command_map[words[0]]
+	if !ok {
+		// we don't know the command
+		return fmt.Sprintln("sorry, that does not compute"), nil
+	}
+	c.action = words[0]
+	c.args = words[1:]
+	msg, _, err := execute(act, c, skedState, auditLog)
+	return msg, err
+}
+
+// execute runs act for c, persists the state if it changed, and records
+// c in the audit log. It returns sked's response, whether the state
+// changed, and any error persisting it.
+func execute(act action, c command, skedState *State, auditLog *AuditLog) (msg string, changed bool, err error) {
+	msg, changed, err = perform(act, c, skedState)
+
+	// write to command log
+	auditErr := auditLog.Write(AuditEntry{
+		Time:     c.at,
+		User:     c.user,
+		Channel:  c.channel,
+		Rotation: c.rotation,
+		Action:   c.action,
+		Args:     c.args,
+		Response: msg,
+		Changed:  changed,
+	})
+	if auditErr != nil {
+		log.Printf("Problem while writing to the audit log, err: %v", auditErr)
+	}
+	return msg, changed, err
+}
+
+// perform runs act for c with the state locked, and persists the state if
+// it changed. A command which panics is logged and answered with an
+// apology, rather than taking sked down or leaving the state locked.
+func perform(act action, c command, skedState *State) (msg string, changed bool, err error) {
+	skedState.Lock()
+	defer skedState.Unlock()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("%v %v panicked: %v\n%s", c.action, c.args, r, debug.Stack())
+			msg = fmt.Sprintf("sorry, something went wrong running %v - help %v shows how to use it", c.action, c.action)
+			changed, err = false, nil
+		}
+	}()
+	marked := skedState.changes.marked
+	msg = act.function(c, skedState)
+	changed = skedState.changes.marked != marked
+	if changed {
+		err = skedState.Persist()
+	}
+	return msg, changed, err
+}
+
 func helpAction(command_map map[string]action, parts []string) string {
 	if len(parts) > 2 {
 		act, ok := command_map[parts[2]]
@@ -189,14 +348,28 @@ func helpAction(command_map map[string]action, parts []string) string {
 }
 
 func getCurrent(cc command, s *State) string {
-	w, err := s.Schedule.Current()
+	r, err := s.rotation(cc)
 	if err != nil {
 		return err.Error()
 	}
-	return w.Identifier()
+	if r.Schedule == nil {
+		return "There's no schedule yet - try build"
+	}
+	shift, err := r.Schedule.GetShift(cc.now())
+	if err != nil {
+		return err.Error()
+	}
+	return shift.Worker().Identifier()
 }
 
 func addPerson(cc command, s *State) string {
+	if len(cc.args) < 1 {
+		return "add <name> [ordering_num]"
+	}
+	r, err := s.rotation(cc)
+	if err != nil {
+		return err.Error()
+	}
 	name := cc.args[0]
 	var ordering int
 	if len(cc.args) > 1 {
@@ -208,135 +381,827 @@ func addPerson(cc command, s *State) string {
 	} else {
 		ordering = 0
 	}
-	err := s.AddPerson(name, ordering)
+	err = s.AddMember(r, name, ordering)
 	if err == nil {
-		return fmt.Sprintf("%v add with ordering %v", name, s.People[name].Ordering())
+		return fmt.Sprintf("%v add with ordering %v", name, r.Members[name].OrderNum)
 	} else {
 		return fmt.Sprintf("%v", err)
 	}
 }
 
 func addUnavailable(cc command, s *State) string {
+	if len(cc.args) < 2 {
+		return "unavail <name> <date> [to <date>] or unavail <name> every <day> [<time> to <time>]"
+	}
+	s.pruneUnavailability(cc.now())
+	switch cc.args[0] {
+	case "list":
+		return listUnavailable(cc, s)
+	case "remove":
+		return removeUnavailable(cc, s)
+	}
 	name := cc.args[0]
 	p, ok := s.People[name]
 	if !ok {
 		return fmt.Sprintf("I don't know anyone named %v", name)
 	}
-	startDate, err := getDate(cc.args[1])
-	var endDate time.Time
-	if err != nil {
-		return fmt.Sprintf("I had trouble understanding the date %v, please use the format [YYYY]MMDD[HH]", cc.args[1])
-	}
-	if len(cc.args) == 4 {
-		endDate, err = getDate(cc.args[3])
+	if cc.args[1] == "every" {
+		r, err := ParseRecurrence(cc.args[2:])
 		if err != nil {
-			return fmt.Sprintf("I had trouble understanding the date %v, please use the format [YYYY]MMDD[HH]", cc.args[1])
-		}
-	} else {
-		switch len(cc.args[1]) {
-		case 4, 8:
-			endDate = startDate.Add(time.Hour * 24)
-		case 6, 10:
-			endDate = startDate.Add(time.Hour)
+			return err.Error()
 		}
+		p.AddRecurring(r)
+		s.personChanged(name)
+		return fmt.Sprintf("Recorded: %v is unavailable %v", name, r)
 	}
-	aInterval, err := NewInterval(startDate, endDate)
+	when, err := parseSpan(cc.args[1:], s.now(cc), time.Hour)
 	if err != nil {
-		return fmt.Sprintf("Your end time:%v is before your start time:%v", endDate, startDate)
+		return err.Error()
 	}
-	p.AddUnavailable(aInterval)
-	return fmt.Sprintf("Recorded: %v is unavailable from %v to %v", name, startDate, endDate)
+	p.AddUnavailable(when)
+	s.personChanged(name)
+	loc := s.zone(cc)
+	return fmt.Sprintf("Recorded: %v is unavailable from %v to %v", name,
+		when.Start().In(loc).Format(TIME_FORMAT), when.End().In(loc).Format(TIME_FORMAT))
 }
 
-// Given a string representing a date in one of several formats, get
-// the Time object
-func getDate(dateStr string) (time.Time, error) {
-	loc := time.Now().Location()
-	var date time.Time
-	var err error
-	switch len(dateStr) {
-	case 4, 6:
-		dateStr := fmt.Sprintf("%v%v", time.Now().Year(), dateStr)
-		date, err = time.ParseInLocation("20060102", dateStr, loc)
-	case 8:
-		date, err = time.ParseInLocation("20060102", dateStr, loc)
-	case 10:
-		date, err = time.ParseInLocation("2006010215", dateStr, loc)
+func listUnavailable(cc command, s *State) string {
+	name := cc.args[1]
+	p, ok := s.People[name]
+	if !ok {
+		return fmt.Sprintf("I don't know anyone named %v", name)
 	}
+	if len(p.Unavailability) == 0 && len(p.Recurring) == 0 {
+		return fmt.Sprintf("%v is always available", name)
+	}
+	loc := s.zone(cc)
+	lines := []string{fmt.Sprintf("%v is unavailable:", name)}
+	for _, u := range p.Unavailability {
+		lines = append(lines, fmt.Sprintf("%v: from %v to %v", u.(*Unavailable).ID,
+			u.Start().In(loc).Format(TIME_FORMAT), u.End().In(loc).Format(TIME_FORMAT)))
+	}
+	for _, r := range p.Recurring {
+		lines = append(lines, fmt.Sprintf("%v: %v", r.ID, r))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func removeUnavailable(cc command, s *State) string {
+	if len(cc.args) != 3 {
+		return "unavail remove <name> <id> - unavail list <name> shows the ids"
+	}
+	name, id := cc.args[1], cc.args[2]
+	p, ok := s.People[name]
+	if !ok {
+		return fmt.Sprintf("I don't know anyone named %v", name)
+	}
+	i, err := strconv.Atoi(id)
+	if err != nil || !p.RemoveUnavailable(i) {
+		return fmt.Sprintf("%v doesn't have an unavailability %v - unavail list %v shows the ids", name, id, name)
+	}
+	s.personChanged(name)
+	return fmt.Sprintf("Removed %v's unavailability %v", name, id)
+}
+
+func preferCmd(cc command, s *State) string {
+	if len(cc.args) < 2 {
+		return "prefer <name> [not] <date> [to <date>]"
+	}
+	s.pruneUnavailability(cc.now())
+	switch cc.args[0] {
+	case "list":
+		return listPreferences(cc, s)
+	case "remove":
+		return removePreference(cc, s)
+	}
+	name := cc.args[0]
+	p, ok := s.People[name]
+	if !ok {
+		return fmt.Sprintf("I don't know anyone named %v", name)
+	}
+	args := cc.args[1:]
+	prefer := true
+	if args[0] == "not" {
+		prefer = false
+		args = args[1:]
+	}
+	when, err := parseSpan(args, s.now(cc), time.Hour)
+	if err != nil {
+		return err.Error()
+	}
+	p.AddPreference(when, prefer)
+	s.personChanged(name)
+	loc := s.zone(cc)
+	not := ""
+	if !prefer {
+		not = " not"
+	}
+	return fmt.Sprintf("Recorded: %v would rather%v work from %v to %v", name, not,
+		when.Start().In(loc).Format(TIME_FORMAT), when.End().In(loc).Format(TIME_FORMAT))
+}
+
+func listPreferences(cc command, s *State) string {
+	name := cc.args[1]
+	p, ok := s.People[name]
+	if !ok {
+		return fmt.Sprintf("I don't know anyone named %v", name)
+	}
+	if len(p.Preferences) == 0 {
+		return fmt.Sprintf("%v doesn't have any preferences", name)
+	}
+	loc := s.zone(cc)
+	lines := []string{fmt.Sprintf("%v would rather:", name)}
+	for _, pref := range p.Preferences {
+		not := ""
+		if !pref.Prefer {
+			not = "not "
+		}
+		lines = append(lines, fmt.Sprintf("%v: %vwork from %v to %v", pref.ID, not,
+			pref.Start().In(loc).Format(TIME_FORMAT), pref.End().In(loc).Format(TIME_FORMAT)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func removePreference(cc command, s *State) string {
+	if len(cc.args) != 3 {
+		return "prefer remove <name> <id> - prefer list <name> shows the ids"
+	}
+	name, id := cc.args[1], cc.args[2]
+	p, ok := s.People[name]
+	if !ok {
+		return fmt.Sprintf("I don't know anyone named %v", name)
+	}
+	i, err := strconv.Atoi(id)
+	if err != nil || !p.RemovePreference(i) {
+		return fmt.Sprintf("%v doesn't have a preference %v - prefer list %v shows the ids", name, id, name)
+	}
+	s.personChanged(name)
+	return fmt.Sprintf("Removed %v's preference %v", name, id)
+}
+
+func whoCmd(cc command, s *State) (msg string) {
+	r, err := s.rotation(cc)
 	if err != nil {
-		return time.Time{}, err
+		return err.Error()
+	}
+	if r.Schedule == nil || r.Schedule.NumShifts() == 0 {
+		return "There's no schedule yet - try build"
+	}
+	loc := s.zone(cc)
+	when, err := getWhen(cc.args, s.now(cc))
+	if err != nil {
+		return err.Error()
+	}
+	shifts := r.Schedule.GetShifts(when)
+	if len(shifts) == 0 {
+		first := r.Schedule.ShiftsList[0]
+		last := r.Schedule.ShiftsList[r.Schedule.NumShifts()-1]
+		return fmt.Sprintf("I don't have anyone scheduled then - the schedule only goes from %v to %v",
+			first.Start().In(loc).Format(TIME_FORMAT), last.End().In(loc).Format(TIME_FORMAT))
+	}
+	lines := make([]string, len(shifts))
+	for i, shift := range shifts {
+		lines[i] = shift.Format(loc)
 	}
-	return date, nil
+	return strings.Join(lines, "\n")
+}
+
+// getWhen works out the span of time the arguments to "who" refer to. No
+// arguments means right now, a date without a time of day means that
+// whole day.
+func getWhen(args []string, now time.Time) (*Interval, error) {
+	switch strings.ToLower(strings.Join(args, " ")) {
+	case "":
+		return &Interval{now, now.Add(time.Nanosecond)}, nil
+	case "this week":
+		sunday := getLastWeekday(now, time.Sunday)
+		return &Interval{sunday, sunday.AddDate(0, 0, 7)}, nil
+	case "next week":
+		sunday := getLastWeekday(now, time.Sunday).AddDate(0, 0, 7)
+		return &Interval{sunday, sunday.AddDate(0, 0, 7)}, nil
+	}
+	return parseSpan(args, now, time.Nanosecond)
 }
 
 func list(cc command, s *State) (msg string) {
-	people_names := make([]string, len(s.People))
-	i := 0
-	for name, _ := range s.People {
-		people_names[i] = name
-		i += 1
-	}
-	msg = strings.Join(people_names, ", ")
-	if len(s.People) == 0 {
+	r, err := s.rotation(cc)
+	if err != nil {
+		return err.Error()
+	}
+	msg = strings.Join(r.MemberNames(), ", ")
+	if len(r.Members) == 0 {
 		msg = fmt.Sprintf("List is empty")
 	}
 	return msg
 }
 
 func removePerson(cc command, s *State) (msg string) {
+	if len(cc.args) < 1 {
+		return "remove <name>"
+	}
+	r, err := s.rotation(cc)
+	if err != nil {
+		return err.Error()
+	}
 	name := cc.args[0]
-	_, ok := s.People[name]
-	if !ok {
-		return fmt.Sprintf("Could not find '%v'", name)
+	err = s.RemoveMember(r, name)
+	if err != nil {
+		return err.Error()
 	} else {
-		delete(s.People, name)
 		return fmt.Sprintf("'%v' was removed from the list!", name)
 	}
 }
 
 func buildSchedule(cc command, s *State) (msg string) {
-	sched := s.BuildSchedule(time.Now(), time.Now().Add(time.Hour*24*7*10))
-	s.Schedule = sched
-	return "```" + sched.String() + "```"
+	r, err := s.rotation(cc)
+	if err != nil {
+		return err.Error()
+	}
+	// account for anything worked under the old schedule before replacing it
+	now := cc.now()
+	s.CommitShifts(now)
+	sched, warnings := s.BuildRotation(r, now, now.Add(time.Hour*24*7*10), s.zone(cc))
+	r.Schedule = sched
+	s.rotationChanged(r.Name)
+	msg = "```" + s.FormatSchedule(sched, s.zone(cc)) + "```"
+	if len(warnings) > 0 {
+		msg += "\nI had to go against some preferences:\n" + strings.Join(warnings, "\n")
+	}
+	return msg
 }
 
 func getSchedule(cc command, s *State) (msg string) {
-	if s.Schedule != nil && s.Schedule.NumShifts() > 0 {
-		return "```" + s.Schedule.String() + "```"
+	r, err := s.rotation(cc)
+	if err != nil {
+		return err.Error()
+	}
+	if r.Schedule != nil && r.Schedule.NumShifts() > 0 {
+		return "```" + s.FormatSchedule(r.Schedule, s.zone(cc)) + "```"
 	} else {
 		return buildSchedule(cc, s)
 	}
 }
 
 func editScheduleCmd(cc command, s *State) (msg string) {
-	// parse args - call edit Schedule
-	name := cc.args[0]
-	start, err := getDate(cc.args[1])
+	r, err := s.rotation(cc)
 	if err != nil {
-		return fmt.Sprintf("%v is not a valid date. Error: %v", cc.args[1], err)
+		return err.Error()
 	}
-	end, err := getDate(cc.args[3])
+	if r.Schedule == nil {
+		return "There's no schedule yet - try build"
+	}
+	if len(cc.args) < 2 {
+		return "edit <name> <date> to <date>"
+	}
+	name := cc.args[0]
+	when, err := parseSpan(cc.args[1:], s.now(cc), time.Hour)
 	if err != nil {
-		return fmt.Sprintf("%v is not a valid date. Error: %v", cc.args[3], err)
+		return err.Error()
 	}
 
 	person, ok := s.People[name]
 	if !ok {
 		return "No one named: " + name
 	}
-	editSchedule(person, start, end, s)
+	editSchedule(person, when.Start(), when.End(), r)
+	s.rotationChanged(r.Name)
 	return "Schedule was edited"
 }
 
-func editSchedule(person *Person, start time.Time, end time.Time, s *State) {
-	s.Schedule.AddShift(person, start, end)
+func cadenceCmd(cc command, s *State) (msg string) {
+	r, err := s.rotation(cc)
+	if err != nil {
+		return err.Error()
+	}
+	if len(cc.args) == 0 {
+		return fmt.Sprintf("Shifts change hands %v", r.ShiftGenerator())
+	}
+	c, err := ParseCadence(cc.args, r.Offset)
+	if err != nil {
+		return err.Error()
+	}
+	r.Cadence = c
+	s.rotationChanged(r.Name)
+	return fmt.Sprintf("Shifts will change hands %v - build to apply it to the schedule", c)
+}
+
+func restCmd(cc command, s *State) (msg string) {
+	r, err := s.rotation(cc)
+	if err != nil {
+		return err.Error()
+	}
+	if len(cc.args) > 0 {
+		n, err := strconv.Atoi(cc.args[0])
+		if err != nil || n < 0 {
+			return fmt.Sprintf("Couldn't understand the number you passed in: %v", cc.args[0])
+		}
+		r.MinRest = n
+		s.rotationChanged(r.Name)
+		return fmt.Sprintf("People will get %v off between %v shifts - build to apply it to the schedule", pluralize(n, "shift"), r.Name)
+	}
+	return fmt.Sprintf("People get %v off between %v shifts", pluralize(r.MinRest, "shift"), r.Name)
+}
+
+func strategyCmd(cc command, s *State) (msg string) {
+	r, err := s.rotation(cc)
+	if err != nil {
+		return err.Error()
+	}
+	if len(cc.args) == 0 {
+		strategy := r.Strategy
+		if strategy == "" {
+			strategy = STRATEGIES[0]
+		}
+		return fmt.Sprintf("%v uses the %v strategy", r.Name, strategy)
+	}
+	strategy, err := parseStrategy(cc.args[0])
+	if err != nil {
+		return err.Error()
+	}
+	if strategy == "random" {
+		seed := cc.now().UnixNano()
+		if len(cc.args) > 1 {
+			seed, err = strconv.ParseInt(cc.args[1], 10, 64)
+			if err != nil {
+				return fmt.Sprintf("Couldn't understand the seed you passed in: %v", cc.args[1])
+			}
+		}
+		r.Seed = seed
+	}
+	r.Strategy = strategy
+	s.rotationChanged(r.Name)
+	return fmt.Sprintf("%v will use the %v strategy - build to apply it to the schedule", r.Name, strategy)
+}
+
+func solverCmd(cc command, s *State) (msg string) {
+	r, err := s.rotation(cc)
+	if err != nil {
+		return err.Error()
+	}
+	if len(cc.args) > 0 {
+		switch cc.args[0] {
+		case "on":
+			var budget time.Duration
+			if len(cc.args) > 1 {
+				budget, err = parseLead(cc.args[1])
+				if err != nil || budget <= 0 {
+					return fmt.Sprintf("I had trouble understanding the time limit %v, please use a format like 5s or 1m", cc.args[1])
+				}
+				if budget > MAX_SOLVER_BUDGET {
+					return fmt.Sprintf("The solver can take at most %v, %v is too long", MAX_SOLVER_BUDGET, cc.args[1])
+				}
+			}
+			r.Solver = true
+			r.SolverBudget = budget
+		case "off":
+			r.Solver = false
+		default:
+			return "solver [on [limit]|off]"
+		}
+		s.rotationChanged(r.Name)
+	}
+	if !r.Solver {
+		return fmt.Sprintf("%v is built one shift at a time", r.Name)
+	}
+	budget := r.SolverBudget
+	if budget == 0 {
+		budget = DEFAULT_SOLVER_BUDGET
+	}
+	return fmt.Sprintf("%v is built by the solver, which can take up to %v", r.Name, budget)
+}
+
+func holidayCmd(cc command, s *State) (msg string) {
+	if len(cc.args) == 0 || cc.args[0] == "list" {
+		if len(s.Holidays) == 0 {
+			return "There are no holidays"
+		}
+		lines := make([]string, len(s.Holidays))
+		for i, h := range s.Holidays {
+			lines[i] = h.String()
+		}
+		return strings.Join(lines, "\n")
+	}
+	if len(cc.args) == 2 && cc.args[0] == "import" {
+		data, err := readHolidayFile(cc.args[1])
+		if err != nil {
+			return err.Error()
+		}
+		holidays, err := ParseHolidays(cc.args[1], data, s.zone(cc))
+		if err != nil {
+			return fmt.Sprintf("Couldn't read the holidays in %v: %v", cc.args[1], err)
+		}
+		return fmt.Sprintf("Added %v - build to apply them to the schedule", pluralize(s.ImportHolidays(holidays), "holiday"))
+	}
+	if len(cc.args) < 2 || (cc.args[0] != "add" && cc.args[0] != "remove") {
+		return "holiday [list|add <date> [name]|remove <date>|import <file>]"
+	}
+	date, _, n, err := parseDate(cc.args[1:], s.now(cc))
+	if err != nil {
+		return err.Error()
+	}
+	date = atMidnight(date)
+	if cc.args[0] == "remove" {
+		if !s.RemoveHoliday(date) {
+			return fmt.Sprintf("%v isn't a holiday", date.Format("Mon Jan 2 2006"))
+		}
+		return fmt.Sprintf("%v is no longer a holiday", date.Format("Mon Jan 2 2006"))
+	}
+	name := strings.Join(cc.args[1+n:], " ")
+	s.AddHoliday(date, name)
+	return fmt.Sprintf("Added the holiday %v - build to apply it to the schedule", Holiday{date, name})
+}
+
+func weightsCmd(cc command, s *State) (msg string) {
+	r, err := s.rotation(cc)
+	if err != nil {
+		return err.Error()
+	}
+	args := cc.args
+	for len(args) > 0 {
+		if len(args) < 2 || (args[0] != "weekend" && args[0] != "holiday") {
+			return "weights [weekend <n>] [holiday <n>]"
+		}
+		weight, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || weight <= 0 {
+			return fmt.Sprintf("Couldn't understand the weight you passed in: %v", args[1])
+		}
+		if args[0] == "weekend" {
+			r.WeekendWeight = weight
+		} else {
+			r.HolidayWeight = weight
+		}
+		s.rotationChanged(r.Name)
+		args = args[2:]
+	}
+	weekend, holiday := r.Weights()
+	return fmt.Sprintf("In %v an hour on a weekend counts %v times and on a holiday %v times as much as any other", r.Name, weekend, holiday)
+}
+
+func historyCmd(cc command, s *State) (msg string) {
+	r, err := s.rotation(cc)
+	if err != nil {
+		return err.Error()
+	}
+	args := cc.args
+	var name string
+	if len(args) > 0 && args[0] != "since" {
+		_, _, n, err := parseDate(args, s.now(cc))
+		if err != nil || n != len(args) || len(s.WorkedBy(args[0])) > 0 || s.People[args[0]] != nil {
+			name = args[0]
+			args = args[1:]
+		}
+	}
+	if len(args) > 0 && args[0] == "since" {
+		args = args[1:]
+		if len(args) == 0 {
+			return "history [name] [since date]"
+		}
+	}
+	var since time.Time
+	if len(args) > 0 {
+		var n int
+		since, _, n, err = parseDate(args, s.now(cc))
+		if err != nil {
+			return err.Error()
+		}
+		if n != len(args) {
+			return dateError(args).Error()
+		}
+	}
+	records := s.HistorySince(r.Name, name, since)
+	if len(records) == 0 && name != "" {
+		return fmt.Sprintf("%v hasn't worked any shifts", name)
+	} else if len(records) == 0 {
+		return "No one has worked any shifts"
+	}
+	lines := make([]string, len(records))
+	for i, r := range records {
+		lines[i] = r.Format(s.zone(cc))
+	}
+	return "```" + strings.Join(lines, "\n") + "\n\n" + summarizeHistory(records) + "```"
+}
+
+func editSchedule(person *Person, start time.Time, end time.Time, r *Rotation) {
+	r.Schedule.AddShift(person, start, end)
+}
+
+func swapCmd(cc command, s *State) (msg string) {
+	r, err := s.rotation(cc)
+	if err != nil {
+		return err.Error()
+	}
+	if r.Schedule == nil || r.Schedule.NumShifts() == 0 {
+		return "There's no schedule yet - try build"
+	}
+	if len(cc.args) < 3 {
+		return "swap <name> <name> <date> [<date>]"
+	}
+	first, second := cc.args[0], cc.args[1]
+	for _, name := range []string{first, second} {
+		if _, ok := r.Members[name]; !ok {
+			return fmt.Sprintf("I don't know anyone named %v in %v", name, r.Name)
+		}
+	}
+	if first == second {
+		return "Someone can't swap with themselves"
+	}
+	now := s.now(cc)
+	_, _, n, err := parseDate(cc.args[2:], now)
+	if err != nil {
+		return err.Error()
+	}
+	firstShift, err := workerShift(r.Schedule, first, cc.args[2:2+n], now)
+	if err != nil {
+		return err.Error()
+	}
+	var secondShift *Shift
+	if len(cc.args) > 2+n {
+		secondShift, err = workerShift(r.Schedule, second, cc.args[2+n:], now)
+		if err != nil {
+			return err.Error()
+		}
+	} else {
+		for _, shift := range r.Schedule.ShiftsList {
+			if shift.Worker().Identifier() == second && !shift.Start().Before(firstShift.End()) {
+				secondShift = shift
+				break
+			}
+		}
+		if secondShift == nil {
+			return fmt.Sprintf("%v doesn't have a shift after %v's - say which one to swap for", second, first)
+		}
+	}
+	if firstShift.Start().Before(r.CommittedUntil) || secondShift.Start().Before(r.CommittedUntil) {
+		return "Shifts that have already been worked can't be swapped"
+	}
+	loc := s.zone(cc)
+	if !s.People[second].IsAvailable(firstShift) {
+		return fmt.Sprintf("%v isn't available from %v to %v", second,
+			firstShift.Start().In(loc).Format(TIME_FORMAT), firstShift.End().In(loc).Format(TIME_FORMAT))
+	}
+	if !s.People[first].IsAvailable(secondShift) {
+		return fmt.Sprintf("%v isn't available from %v to %v", first,
+			secondShift.Start().In(loc).Format(TIME_FORMAT), secondShift.End().In(loc).Format(TIME_FORMAT))
+	}
+	firstShift.SetWorker(s.People[second])
+	firstShift.Change = SWAPPED
+	secondShift.SetWorker(s.People[first])
+	secondShift.Change = SWAPPED
+	s.rotationChanged(r.Name)
+	return fmt.Sprintf("Swapped:\n%v\n%v", firstShift.Format(loc), secondShift.Format(loc))
+}
+
+// workerShift finds name's first shift during the time args refer to.
+func workerShift(sched *Schedule, name string, args []string, now time.Time) (*Shift, error) {
+	when, err := getWhen(args, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, shift := range sched.GetShifts(when) {
+		if shift.Worker().Identifier() == name {
+			return shift, nil
+		}
+	}
+	return nil, fmt.Errorf("%v isn't on from %v to %v", name,
+		when.Start().In(now.Location()).Format(TIME_FORMAT), when.End().In(now.Location()).Format(TIME_FORMAT))
+}
+
+func coverCmd(cc command, s *State) (msg string) {
+	r, err := s.rotation(cc)
+	if err != nil {
+		return err.Error()
+	}
+	if r.Schedule == nil || r.Schedule.NumShifts() == 0 {
+		return "There's no schedule yet - try build"
+	}
+	if len(cc.args) < 2 {
+		return "cover <name> <date> to <date>"
+	}
+	name := cc.args[0]
+	if _, ok := r.Members[name]; !ok {
+		return fmt.Sprintf("I don't know anyone named %v in %v", name, r.Name)
+	}
+	when, err := parseSpan(cc.args[1:], s.now(cc), time.Hour)
+	if err != nil {
+		return err.Error()
+	}
+	start, end := when.Start(), when.End()
+	loc := s.zone(cc)
+	first := r.Schedule.ShiftsList[0]
+	last := r.Schedule.ShiftsList[r.Schedule.NumShifts()-1]
+	if start.Before(first.Start()) || end.After(last.End()) {
+		return fmt.Sprintf("The schedule only goes from %v to %v",
+			first.Start().In(loc).Format(TIME_FORMAT), last.End().In(loc).Format(TIME_FORMAT))
+	}
+	if start.Before(r.CommittedUntil) {
+		return "Shifts that have already been worked can't be covered"
+	}
+	if !s.People[name].IsAvailable(when) {
+		return fmt.Sprintf("%v isn't available from %v to %v", name,
+			start.In(loc).Format(TIME_FORMAT), end.In(loc).Format(TIME_FORMAT))
+	}
+	covered := []string{}
+	for _, shift := range r.Schedule.GetShifts(when) {
+		worker := shift.Worker().Identifier()
+		if worker != name && (len(covered) == 0 || covered[len(covered)-1] != worker) {
+			covered = append(covered, worker)
+		}
+	}
+	if len(covered) == 0 {
+		return fmt.Sprintf("%v is already on then", name)
+	}
+	r.Schedule.ReplaceShift(s.People[name], start, end, COVERED)
+	s.rotationChanged(r.Name)
+	return fmt.Sprintf("%v is covering for %v from %v to %v", name, strings.Join(covered, ", "),
+		start.In(loc).Format(TIME_FORMAT), end.In(loc).Format(TIME_FORMAT))
 }
 
 func startScheduling(cc command, s *State) (msg string) {
-	go runSchedule(s)
-	return "Schedule started"
+	r, err := s.rotation(cc)
+	if err != nil {
+		return err.Error()
+	}
+	channel := cc.channel
+	if len(cc.args) > 0 {
+		channel = parseChannel(cc.args[0])
+	}
+	if channel == "" {
+		return "Which channel should I announce handoffs in? start <#channel>"
+	}
+	r.Channel = channel
+	s.rotationChanged(r.Name)
+	runSchedule(s)
+	return fmt.Sprintf("Schedule started - %v handoffs will be announced in <#%v>", r.Name, channel)
+}
+
+// Slack sends channel references as <#C024BE7LR|general> - pull out the
+// ID. Anything else is assumed to already be an ID.
+func parseChannel(ref string) string {
+	if strings.HasPrefix(ref, "<#") && strings.HasSuffix(ref, ">") {
+		ref = strings.TrimSuffix(strings.TrimPrefix(ref, "<#"), ">")
+		ref = strings.SplitN(ref, "|", 2)[0]
+	}
+	return ref
 }
 
 func printCal(cc command, s *State) (msg string) {
-	return "```" + s.Schedule.SPrintCalendar() + "```"
+	r, err := s.rotation(cc)
+	if err != nil {
+		return err.Error()
+	}
+	if r.Schedule == nil || r.Schedule.NumShifts() == 0 {
+		return "There's no schedule yet - try build"
+	}
+	return "```" + r.Schedule.SPrintCalendar(s.zone(cc)) + "```"
+}
+
+func remindCmd(cc command, s *State) (msg string) {
+	r, err := s.rotation(cc)
+	if err != nil {
+		return err.Error()
+	}
+	if len(cc.args) == 1 && cc.args[0] == "off" {
+		r.ReminderLeads = nil
+		s.rotationChanged(r.Name)
+		return "Reminders are off"
+	}
+	if len(cc.args) > 0 {
+		leads := make([]time.Duration, len(cc.args))
+		for i, arg := range cc.args {
+			lead, err := parseLead(arg)
+			if err != nil || lead <= 0 {
+				return fmt.Sprintf("I had trouble understanding the lead time %v, please use a format like 24h, 90m or 2d", arg)
+			}
+			leads[i] = lead
+		}
+		r.ReminderLeads = leads
+		s.rotationChanged(r.Name)
+	}
+	if len(r.ReminderLeads) == 0 {
+		return "Reminders are off"
+	}
+	leadStrs := make([]string, len(r.ReminderLeads))
+	for i, lead := range r.ReminderLeads {
+		leadStrs[i] = formatLead(lead)
+	}
+	return fmt.Sprintf("Reminding people %v before their %v shifts", strings.Join(leadStrs, ", "), r.Name)
+}
+
+func contactCmd(cc command, s *State) (msg string) {
+	if len(cc.args) < 2 {
+		return "contact <name> <@user>"
+	}
+	name := cc.args[0]
+	p, ok := s.People[name]
+	if !ok {
+		return fmt.Sprintf("I don't know anyone named %v", name)
+	}
+	user := parseUser(cc.args[1])
+	if user == "" {
+		return fmt.Sprintf("%v doesn't look like a Slack user, try mentioning them with @", cc.args[1])
+	}
+	p.SlackID = user
+	s.personChanged(name)
+	return fmt.Sprintf("I'll send %v's reminders to <@%v>", name, user)
+}
+
+func tzCmd(cc command, s *State) (msg string) {
+	if len(cc.args) < 1 {
+		return "tz <name> [<zone>|off]"
+	}
+	name := cc.args[0]
+	p, ok := s.People[name]
+	if !ok {
+		return fmt.Sprintf("I don't know anyone named %v", name)
+	}
+	if len(cc.args) > 1 {
+		if cc.args[1] == "off" {
+			p.TZ = ""
+		} else {
+			loc, err := time.LoadLocation(cc.args[1])
+			if err != nil || cc.args[1] == "" || cc.args[1] == "Local" {
+				return fmt.Sprintf("I don't know the time zone %v, try a name like America/Chicago or Europe/London", cc.args[1])
+			}
+			p.TZ = loc.String()
+		}
+		s.personChanged(name)
+	}
+	if p.TZ == "" {
+		return fmt.Sprintf("%v's times are in sked's time zone, %v", name, time.Now().Format("MST"))
+	}
+	return fmt.Sprintf("%v's times are in %v", name, p.TZ)
+}
+
+func auditCmd(cc command, s *State) (msg string) {
+	if s.audit == nil {
+		return "I'm not keeping an audit log"
+	}
+	n := 10
+	if len(cc.args) > 0 {
+		var err error
+		n, err = strconv.Atoi(cc.args[0])
+		if err != nil || n < 1 {
+			return fmt.Sprintf("Couldn't understand the number you passed in: %v", cc.args[0])
+		}
+	}
+	entries, err := s.audit.Recent(n)
+	if err != nil {
+		return fmt.Sprintf("I couldn't read the audit log - err: %v", err)
+	}
+	if len(entries) == 0 {
+		return "No commands have been logged"
+	}
+	lines := make([]string, len(entries))
+	for i, e := range entries {
+		e.Time = e.Time.In(s.zone(cc))
+		lines[i] = e.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func rotationCmd(cc command, s *State) (msg string) {
+	if len(cc.args) == 0 || cc.args[0] == "list" {
+		names := s.RotationNames()
+		if len(names) == 0 {
+			return "There are no rotations"
+		}
+		lines := make([]string, len(names))
+		for i, name := range names {
+			r := s.Rotations[name]
+			lines[i] = fmt.Sprintf("%v: %v, shifts change hands %v", name, strings.Join(r.MemberNames(), ", "), r.ShiftGenerator())
+			if name == s.DefaultRotation {
+				lines[i] += " (default)"
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+	if len(cc.args) < 2 {
+		return "rotation [list|add <name>|remove <name>|default <name>]"
+	}
+	name := cc.args[1]
+	switch cc.args[0] {
+	case "add":
+		if _, ok := newCommandMap()[name]; ok || name == "help" {
+			return fmt.Sprintf("%v is a command, please choose a different name", name)
+		}
+		err := s.AddRotation(name)
+		if err != nil {
+			return err.Error()
+		}
+		return fmt.Sprintf("Added rotation %v - address commands to it with %v <command>", name, name)
+	case "remove":
+		err := s.RemoveRotation(name)
+		if err != nil {
+			return err.Error()
+		}
+		return fmt.Sprintf("Removed rotation %v", name)
+	case "default":
+		if _, ok := s.Rotations[name]; !ok {
+			return fmt.Sprintf("I don't know of a rotation named %v", name)
+		}
+		s.DefaultRotation = name
+		s.otherChanged()
+		return fmt.Sprintf("Commands will apply to %v unless another rotation is named", name)
+	}
+	return "rotation [list|add <name>|remove <name>|default <name>]"
 }
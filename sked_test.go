@@ -1,6 +1,248 @@
 package main
 
-import ()
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// inChicago makes time.Local America/Chicago until t is over, for tests of
+// what's shown to someone without a time zone of their own, and returns
+// it.
+func inChicago(t *testing.T) *time.Location {
+	loc, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := time.Local
+	time.Local = loc
+	t.Cleanup(func() { time.Local = local })
+	return loc
+}
+
+func TestGetWhen(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	now := time.Date(2015, time.October, 14, 15, 30, 0, 0, loc)
+
+	when, err := getWhen([]string{}, now)
+	if err != nil || !when.Start().Equal(now) {
+		t.Fatalf("No args should mean now, got: %v, %v", when, err)
+	}
+
+	when, err = getWhen([]string{"next", "week"}, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := &Interval{time.Date(2015, time.October, 18, 0, 0, 0, 0, loc), time.Date(2015, time.October, 25, 0, 0, 0, 0, loc)}
+	if !when.Equal(expected) {
+		t.Fatalf("next week should be %v, not %v", expected, when)
+	}
+
+	_, err = getWhen([]string{"blah"}, now)
+	if err == nil {
+		t.Fatalf("blah isn't a date")
+	}
+}
+
+func TestWho(t *testing.T) {
+	loc := inChicago(t)
+	start := time.Date(2015, time.October, 11, 22, 0, 0, 0, loc)
+	end := time.Date(2015, time.November, 18, 17, 0, 0, 0, loc)
+	s := NewState(time.Wednesday)
+	s.AddPerson("joe", 0)
+	s.Default().Schedule = s.BuildSchedule(start, end)
+
+	msg := whoCmd(command{action: "who", args: []string{"20151015"}}, s)
+	if msg != "joe from Wed Oct 14 00:00 CDT to Wed Oct 21 00:00 CDT" {
+		t.Fatalf("Unexpected response from who: %v", msg)
+	}
+
+	msg = whoCmd(command{action: "who", args: []string{"20151014", "to", "20151022"}}, s)
+	if len(strings.Split(msg, "\n")) != 2 {
+		t.Fatalf("Expected two shifts, got: %v", msg)
+	}
+
+	msg = whoCmd(command{action: "who", args: []string{"20160101"}}, s)
+	if !strings.HasPrefix(msg, "I don't have anyone scheduled then") {
+		t.Fatalf("Expected a friendly error, got: %v", msg)
+	}
+}
+
+func TestSwap(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, time.October, 11, 22, 0, 0, 0, loc)
+	end := time.Date(2015, time.November, 18, 17, 0, 0, 0, loc)
+	s := NewState(time.Wednesday)
+	s.AddPerson("joe", 1)
+	s.AddPerson("bob", 0)
+	s.Default().Schedule = s.BuildSchedule(start, end)
+	sched := s.Default().Schedule
+
+	// joe is on the week of the 14th, bob the week after
+	first, _ := sched.GetShift(time.Date(2015, time.October, 15, 0, 0, 0, 0, loc))
+	second, _ := sched.GetShift(time.Date(2015, time.October, 22, 0, 0, 0, 0, loc))
+	if first.Worker().Identifier() != "joe" || second.Worker().Identifier() != "bob" {
+		t.Fatalf("Unexpected schedule: %v", sched)
+	}
+
+	msg := swapCmd(command{action: "swap", args: []string{"joe", "bob", "20151015"}}, s)
+	if !strings.HasPrefix(msg, "Swapped") {
+		t.Fatalf("Unexpected response from swap: %v", msg)
+	}
+	if first.Worker().Identifier() != "bob" || second.Worker().Identifier() != "joe" ||
+		first.Change != SWAPPED || second.Change != SWAPPED {
+		t.Fatalf("joe and bob should have swapped: %v", sched)
+	}
+
+	msg = swapCmd(command{action: "swap", args: []string{"joe", "bob", "20151015"}}, s)
+	if !strings.HasPrefix(msg, "joe isn't on") {
+		t.Fatalf("joe isn't on the 15th any more, got: %v", msg)
+	}
+
+	unavail, _ := NewInterval(time.Date(2015, time.October, 22, 0, 0, 0, 0, loc), time.Date(2015, time.October, 23, 0, 0, 0, 0, loc))
+	s.People["bob"].AddUnavailable(unavail)
+	msg = swapCmd(command{action: "swap", args: []string{"bob", "joe", "20151015", "20151022"}}, s)
+	if !strings.HasPrefix(msg, "bob isn't available") || first.Worker().Identifier() != "bob" {
+		t.Fatalf("bob can't work joe's shift, got: %v", msg)
+	}
+
+	// whoever actually worked gets credit
+	s.CommitShifts(second.End())
+	if s.History[2].Worker != "joe" || s.History[2].Change != SWAPPED {
+		t.Fatalf("joe should have been credited with the swapped shift: %v", s.History)
+	}
+	msg = swapCmd(command{action: "swap", args: []string{"bob", "joe", "20151015"}}, s)
+	if msg != "Shifts that have already been worked can't be swapped" {
+		t.Fatalf("Shouldn't be able to swap shifts in the past, got: %v", msg)
+	}
+}
+
+func TestCover(t *testing.T) {
+	loc := inChicago(t)
+	start := time.Date(2015, time.October, 11, 22, 0, 0, 0, loc)
+	end := time.Date(2015, time.November, 18, 17, 0, 0, 0, loc)
+	s := NewState(time.Wednesday)
+	s.AddPerson("joe", 1)
+	s.AddPerson("bob", 0)
+	s.Default().Schedule = s.BuildSchedule(start, end)
+	sched := s.Default().Schedule
+
+	unavail, _ := NewInterval(time.Date(2015, time.October, 16, 0, 0, 0, 0, loc), time.Date(2015, time.October, 17, 0, 0, 0, 0, loc))
+	s.People["bob"].AddUnavailable(unavail)
+	msg := coverCmd(command{action: "cover", args: []string{"bob", "2015101512", "to", "2015101612"}}, s)
+	if !strings.HasPrefix(msg, "bob isn't available") {
+		t.Fatalf("bob can't cover while unavailable, got: %v", msg)
+	}
+
+	msg = coverCmd(command{action: "cover", args: []string{"bob", "2015101712", "to", "2015101812"}}, s)
+	if msg != "bob is covering for joe from Sat Oct 17 12:00 CDT to Sun Oct 18 12:00 CDT" {
+		t.Fatalf("Unexpected response from cover: %v", msg)
+	}
+	if sched.NumShifts() != 9 {
+		t.Fatalf("joe's shift should have been split in three: %v", sched)
+	}
+	covered, _ := sched.GetShift(time.Date(2015, time.October, 18, 0, 0, 0, 0, loc))
+	after, _ := sched.GetShift(time.Date(2015, time.October, 19, 0, 0, 0, 0, loc))
+	if covered.Worker().Identifier() != "bob" || covered.Change != COVERED || after.Worker().Identifier() != "joe" {
+		t.Fatalf("bob should be covering part of joe's shift: %v", sched)
+	}
+
+	msg = coverCmd(command{action: "cover", args: []string{"bob", "2015101714", "to", "2015101716"}}, s)
+	if msg != "bob is already on then" {
+		t.Fatalf("bob is already covering then, got: %v", msg)
+	}
+	msg = coverCmd(command{action: "cover", args: []string{"bob", "20160101", "to", "20160102"}}, s)
+	if !strings.HasPrefix(msg, "The schedule only goes") {
+		t.Fatalf("Can't cover outside the schedule, got: %v", msg)
+	}
+}
+
+func TestTimeZones(t *testing.T) {
+	loc := inChicago(t)
+	london, _ := time.LoadLocation("Europe/London")
+	start := time.Date(2015, time.October, 11, 22, 0, 0, 0, loc)
+	end := time.Date(2015, time.November, 18, 17, 0, 0, 0, loc)
+	s := NewState(time.Wednesday)
+	s.AddPerson("joe", 0)
+	s.AddPerson("bob", 1)
+	s.Default().Schedule = s.BuildSchedule(start, end)
+	contactCmd(command{action: "contact", args: []string{"bob", "<@U024BE7LH>"}}, s)
+
+	msg := tzCmd(command{action: "tz", args: []string{"bob", "Mars/Olympus_Mons"}}, s)
+	if !strings.HasPrefix(msg, "I don't know the time zone") {
+		t.Fatalf("Mars/Olympus_Mons isn't a time zone, got: %v", msg)
+	}
+	msg = tzCmd(command{action: "tz", args: []string{"bob", "Europe/London"}}, s)
+	if msg != "bob's times are in Europe/London" || s.People["bob"].TZ != "Europe/London" {
+		t.Fatalf("Unexpected response from tz: %v", msg)
+	}
+
+	// bob's dates are read, and times shown, in London
+	bob := command{action: "who", args: []string{"2015-10-14", "05:00"}, user: "U024BE7LH"}
+	msg = whoCmd(bob, s)
+	if msg != "joe from Wed Oct 7 06:00 BST to Wed Oct 14 06:00 BST" {
+		t.Fatalf("Unexpected response from who: %v", msg)
+	}
+	msg = whoCmd(command{action: "who", args: []string{"2015-10-14", "06:00"}}, s)
+	if msg != "bob from Wed Oct 14 00:00 CDT to Wed Oct 21 00:00 CDT" {
+		t.Fatalf("Unexpected response from who: %v", msg)
+	}
+
+	bob.action = "unavail"
+	bob.args = []string{"bob", "2015-10-20", "09:00"}
+	addUnavailable(bob, s)
+	unavail := s.People["bob"].Unavailability[0]
+	if !unavail.Start().Equal(time.Date(2015, time.October, 20, 9, 0, 0, 0, london)) {
+		t.Fatalf("bob's unavailability should be in London time, got: %v", unavail)
+	}
+}
+
+func TestUnavailListRemove(t *testing.T) {
+	loc := inChicago(t)
+	now := time.Date(2015, time.October, 14, 12, 0, 0, 0, loc)
+	s := NewState(time.Wednesday)
+	s.AddPerson("joe", 0)
+
+	msg := addUnavailable(command{action: "unavail", args: []string{"list", "joe"}, at: now}, s)
+	if msg != "joe is always available" {
+		t.Fatalf("Unexpected response from unavail list: %v", msg)
+	}
+	for _, args := range []string{"joe 20151013", "joe 20151020", "joe 20151021", "joe every friday"} {
+		addUnavailable(command{action: "unavail", args: strings.Fields(args), at: now}, s)
+	}
+	addUnavailable(command{action: "unavail", args: []string{"remove", "joe", "3"}, at: now}, s)
+	msg = addUnavailable(command{action: "unavail", args: []string{"list", "joe"}, at: now}, s)
+	if msg != "joe is unavailable:\n2: from Tue Oct 20 00:00 CDT to Wed Oct 21 00:00 CDT\n4: every friday" {
+		t.Fatalf("The 13th is over and the 21st was removed, without renumbering the rest, got: %v", msg)
+	}
+	msg = addUnavailable(command{action: "unavail", args: []string{"remove", "joe", "1"}, at: now}, s)
+	if !strings.HasPrefix(msg, "joe doesn't have an unavailability 1") {
+		t.Fatalf("The 13th was pruned, got: %v", msg)
+	}
+	addUnavailable(command{action: "unavail", args: []string{"remove", "joe", "4"}, at: now}, s)
+	if len(s.People["joe"].Recurring) != 0 || len(s.People["joe"].Unavailability) != 1 {
+		t.Fatalf("Only the 20th should be left, got: %v %v", s.People["joe"].Unavailability, s.People["joe"].Recurring)
+	}
+	addUnavailable(command{action: "unavail", args: []string{"joe", "20151022"}, at: now}, s)
+	msg = addUnavailable(command{action: "unavail", args: []string{"list", "joe"}, at: now}, s)
+	if !strings.HasSuffix(msg, "\n5: from Thu Oct 22 00:00 CDT to Fri Oct 23 00:00 CDT") {
+		t.Fatalf("IDs shouldn't be reused, got: %v", msg)
+	}
+}
+
+func TestPerformPanic(t *testing.T) {
+	s := NewState(time.Wednesday)
+	broken := action{func(cc command, s *State) string { return cc.args[0] }, ""}
+	msg, changed, err := perform(broken, command{action: "broken", args: []string{}}, s)
+	if msg != "sorry, something went wrong running broken - help broken shows how to use it" || changed || err != nil {
+		t.Fatalf("Unexpected response from a command which panicked: %v %v %v", msg, changed, err)
+	}
+	// the state was unlocked, or this would never return
+	msg, _, _ = perform(action{list, ""}, command{action: "list"}, s)
+	if msg == "" {
+		t.Fatalf("list should still work after a command panicked")
+	}
+}
 
 // func TestGetCurrent(t *testing.T) {
 // 	cc := command{}
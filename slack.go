@@ -33,6 +33,7 @@ import (
 	"log"
 	"net/http"
 	"sync/atomic"
+	"time"
 )
 
 // These two structures represent the response of the Slack API rtm.start.
@@ -53,7 +54,7 @@ type responseSelf struct {
 // websocket URL can be used to initiate an RTM session.
 func slackStart(token string) (wsurl, id string, err error) {
 	url := fmt.Sprintf("https://slack.com/api/rtm.start?token=%s", token)
-	resp, err := http.Get(url)
+	resp, err := slackClient.Get(url)
 	if err != nil {
 		return
 	}
@@ -90,6 +91,7 @@ type Message struct {
 	Id      uint64 `json:"id"`
 	Type    string `json:"type"`
 	Channel string `json:"channel"`
+	User    string `json:"user,omitempty"`
 	Text    string `json:"text"`
 }
 
@@ -100,11 +102,74 @@ func getMessage(ws *websocket.Conn) (m Message, err error) {
 
 var counter uint64
 
+// How long to wait for the Slack web API before giving up
+const SLACK_TIMEOUT = 10 * time.Second
+
+var slackClient = &http.Client{Timeout: SLACK_TIMEOUT}
+
 func postMessage(ws *websocket.Conn, m Message) error {
 	m.Id = atomic.AddUint64(&counter, 1)
 	return websocket.JSON.Send(ws, m)
 }
 
+type responseImOpen struct {
+	Ok      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Channel struct {
+		Id string `json:"id"`
+	} `json:"channel"`
+}
+
+// slackOpenIM does an im.open and returns the ID of the direct message
+// channel between the bot and user.
+func slackOpenIM(token string, user string) (channel string, err error) {
+	url := fmt.Sprintf("https://slack.com/api/im.open?token=%s&user=%s", token, user)
+	resp, err := slackClient.Get(url)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("API request failed with code %d", resp.StatusCode)
+		return
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return
+	}
+	var respObj responseImOpen
+	err = json.Unmarshal(body, &respObj)
+	if err != nil {
+		return
+	}
+
+	if !respObj.Ok {
+		err = fmt.Errorf("Slack error: %s", respObj.Error)
+		return
+	}
+
+	channel = respObj.Channel.Id
+	return
+}
+
+// slackNotifier posts the engine's announcements over the RTM websocket.
+type slackNotifier struct {
+	ws    *websocket.Conn
+	token string
+}
+
+func (n slackNotifier) Notify(channel string, text string) error {
+	return postMessage(n.ws, Message{Type: "message", Channel: channel, Text: text})
+}
+
+func (n slackNotifier) DirectMessage(user string, text string) error {
+	channel, err := slackOpenIM(n.token, user)
+	if err != nil {
+		return err
+	}
+	return n.Notify(channel, text)
+}
+
 // Starts a websocket-based Real Time API session and return the websocket
 // and the ID of the (bot-)user whom the token belongs to.
 func slackConnect(token string) (*websocket.Conn, string) {
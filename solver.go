@@ -0,0 +1,225 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// How long the solver searches if its rotation doesn't say
+const DEFAULT_SOLVER_BUDGET = 2 * time.Second
+
+// The longest the solver can be told to search, since everything else
+// waits for a build to finish
+const MAX_SOLVER_BUDGET = time.Minute
+
+// A cost is how bad a schedule is. Costs are compared field by field, so
+// e.g. any number of preferences are worth going against to avoid one
+// empty shift. Rest comes before imbalance, the same as it does for the
+// greedy pass, so the solver only has someone work without a rest when
+// there's no one else, not just to even out the load.
+type cost struct {
+	// Shifts no one works
+	empty int
+	// Shifts someone works without enough rest first
+	rest int
+	// The sum over everyone of the square of the weighted hours they work,
+	// which is lowest when the load is spread evenly
+	imbalance int64
+	// Preferences gone against
+	preferences int
+}
+
+func (c cost) less(o cost) bool {
+	if c.empty != o.empty {
+		return c.empty < o.empty
+	}
+	if c.rest != o.rest {
+		return c.rest < o.rest
+	}
+	if c.imbalance != o.imbalance {
+		return c.imbalance < o.imbalance
+	}
+	return c.preferences < o.preferences
+}
+
+// A solver looks at every way the shifts could be assigned, depth first,
+// for the one with the lowest cost. Every part of a cost only goes up as
+// more shifts are assigned, so it abandons any partial schedule which
+// already costs as much as the best one found so far. The first schedule
+// it finds is close to what the greedy pass would have built, so if it
+// runs out of time it has something at least as good.
+type solver struct {
+	shifts []*Shift
+	people []*Person
+	// Who's available for each shift, as indexes into people
+	available [][]int
+	// What each person thinks of each shift, see Person.PreferenceFor
+	preferences [][]int
+	hours       []int64
+	minRest     int
+	// Who works each shift, -1 if no one, after whoever worked the shifts
+	// just before the schedule
+	assigned []int
+	before   int
+	// Weighted hours each person has worked in the rotation, including the
+	// shifts assigned so far
+	worked []int64
+	cur    cost
+
+	best         cost
+	bestAssigned []int
+	found        bool
+
+	deadline time.Time
+	nodes    int
+	timedOut bool
+}
+
+// solve works out who should work each shift in sched, out of personList
+// in the order strategy puts them, with recent being who worked the shifts
+// just before it and worked the weighted hours each person has worked
+// already, by name. Returns the workers and whether it finished searching
+// within budget.
+func solve(sched *Schedule, personList []*Person, strategy Strategy, recent []string, worked map[string]time.Duration,
+	minRest int, budget time.Duration, weigh func(Intervaler) float64) (map[*Shift]*Person, bool) {
+	if budget <= 0 {
+		budget = DEFAULT_SOLVER_BUDGET
+	}
+	people := append([]*Person{}, personList...)
+	if sched.NumShifts() > 0 {
+		strategy.Order(people, sched.ShiftsList[0])
+	}
+	sv := &solver{
+		shifts:      sched.ShiftsList,
+		people:      people,
+		available:   make([][]int, sched.NumShifts()),
+		preferences: make([][]int, sched.NumShifts()),
+		hours:       make([]int64, sched.NumShifts()),
+		minRest:     minRest,
+		worked:      make([]int64, len(people)),
+		deadline:    time.Now().Add(budget),
+	}
+	for j, p := range people {
+		sv.worked[j] = int64(math.Round(worked[p.Name].Hours()))
+	}
+	for i, shift := range sv.shifts {
+		sv.hours[i] = int64(math.Round(weigh(shift) * shift.End().Sub(shift.Start()).Hours()))
+		sv.preferences[i] = make([]int, len(people))
+		for j, p := range people {
+			sv.preferences[i][j] = p.PreferenceFor(shift)
+			if p.IsAvailable(shift) {
+				sv.available[i] = append(sv.available[i], j)
+			}
+		}
+	}
+	for _, name := range recent {
+		worker := -1
+		for j, p := range people {
+			if p.Name == name {
+				worker = j
+			}
+		}
+		sv.assigned = append(sv.assigned, worker)
+	}
+	sv.before = len(sv.assigned)
+	sv.search(0)
+
+	solved := make(map[*Shift]*Person)
+	for i, shift := range sv.shifts {
+		if worker := sv.bestAssigned[sv.before+i]; worker >= 0 {
+			solved[shift] = people[worker]
+		}
+	}
+	return solved, !sv.timedOut
+}
+
+func (sv *solver) search(i int) {
+	sv.nodes += 1
+	if sv.nodes%256 == 0 && time.Now().After(sv.deadline) {
+		sv.timedOut = true
+	}
+	if sv.timedOut && sv.found {
+		return
+	}
+	if sv.found && !sv.cur.less(sv.best) {
+		return
+	}
+	if i == len(sv.shifts) {
+		sv.best = sv.cur
+		sv.bestAssigned = append([]int{}, sv.assigned...)
+		sv.found = true
+		return
+	}
+	if len(sv.available[i]) == 0 {
+		sv.assigned = append(sv.assigned, -1)
+		sv.cur.empty += 1
+		sv.search(i + 1)
+		sv.cur.empty -= 1
+		sv.assigned = sv.assigned[:len(sv.assigned)-1]
+		return
+	}
+	for _, j := range sv.candidates(i) {
+		prev := sv.cur
+		if !sv.rested(j) {
+			sv.cur.rest += 1
+		}
+		sv.cur.imbalance += (sv.worked[j]+sv.hours[i])*(sv.worked[j]+sv.hours[i]) - sv.worked[j]*sv.worked[j]
+		sv.cur.preferences += sv.overridden(i, j)
+		sv.worked[j] += sv.hours[i]
+		sv.assigned = append(sv.assigned, j)
+
+		sv.search(i + 1)
+
+		sv.assigned = sv.assigned[:len(sv.assigned)-1]
+		sv.worked[j] -= sv.hours[i]
+		sv.cur = prev
+		if sv.timedOut && sv.found {
+			return
+		}
+	}
+}
+
+// candidates returns who's available for shift i, most promising first:
+// people who've had enough rest, then who's worked least so far, then who
+// would most like to work it, then in the strategy's order.
+func (sv *solver) candidates(i int) []int {
+	candidates := append([]int{}, sv.available[i]...)
+	sort.SliceStable(candidates, func(a, b int) bool {
+		ja, jb := candidates[a], candidates[b]
+		if sv.rested(ja) != sv.rested(jb) {
+			return sv.rested(ja)
+		}
+		if sv.worked[ja] != sv.worked[jb] {
+			return sv.worked[ja] < sv.worked[jb]
+		}
+		return sv.preferences[i][ja] > sv.preferences[i][jb]
+	})
+	return candidates
+}
+
+// rested returns whether person j didn't work any of the last minRest
+// shifts assigned.
+func (sv *solver) rested(j int) bool {
+	for k := len(sv.assigned) - 1; k >= 0 && k >= len(sv.assigned)-sv.minRest; k-- {
+		if sv.assigned[k] == j {
+			return false
+		}
+	}
+	return true
+}
+
+// overridden counts the preferences gone against by person j working
+// shift i, the same way preferenceWarnings does.
+func (sv *solver) overridden(i int, j int) int {
+	n := 0
+	if sv.preferences[i][j] < 0 {
+		n += 1
+	}
+	for _, k := range sv.available[i] {
+		if k != j && sv.preferences[i][k] > 0 {
+			n += 1
+		}
+	}
+	return n
+}
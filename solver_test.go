@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSolver(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, time.October, 12, 12, 0, 0, 0, loc)
+	end := time.Date(2015, time.October, 14, 12, 0, 0, 0, loc)
+
+	s := NewState(time.Wednesday)
+	s.AddPerson("joe", 0)
+	s.AddPerson("bob", 1)
+	r := s.Default()
+	r.Cadence = Cadence{Days: 1}
+	r.Members["joe"].PriorityNum = -10
+	bob, _ := NewInterval(time.Date(2015, time.October, 13, 0, 0, 0, 0, loc), end.AddDate(0, 0, 1))
+	s.People["bob"].AddUnavailable(bob)
+
+	// joe goes first, so has to work every day
+	sched, warnings := s.BuildRotation(r, start, end, loc)
+	if got := strings.Join(workers(sched), " "); got != "joe joe joe" || len(warnings) != 2 {
+		t.Fatalf("Expected joe to work every day, got: %v, %v", got, warnings)
+	}
+
+	msg := solverCmd(command{action: "solver", args: []string{"on"}}, s)
+	if msg != "support is built by the solver, which can take up to 2s" {
+		t.Fatalf("Unexpected response from solver: %v", msg)
+	}
+	sched, warnings = s.BuildRotation(r, start, end, loc)
+	if got := strings.Join(workers(sched), " "); got != "bob joe joe" || len(warnings) != 1 {
+		t.Fatalf("bob should work the first day, got: %v, %v", got, warnings)
+	}
+}
+
+func TestSolverHistory(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, time.October, 12, 0, 0, 0, 0, loc)
+	end := start.AddDate(0, 0, 4)
+
+	s := NewState(time.Wednesday)
+	s.AddPerson("joe", 0)
+	s.AddPerson("bob", 1)
+	r := s.Default()
+	r.Cadence = Cadence{Days: 1}
+	r.MinRest = 0
+	solverCmd(command{action: "solver", args: []string{"on"}}, s)
+	// bob has already worked two days more than joe
+	s.History = []*ShiftRecord{{StartTime: start.AddDate(0, 0, -2), EndTime: start, Worker: "bob", Rotation: r.Name}}
+
+	sched, _ := s.BuildRotation(r, start, end, loc)
+	bob := 0
+	for _, name := range workers(sched) {
+		if name == "bob" {
+			bob += 1
+		}
+	}
+	if bob != 1 {
+		t.Fatalf("joe should work all but one day to catch up with bob, got: %v", workers(sched))
+	}
+}
+
+func TestSolverBudget(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, time.October, 12, 12, 0, 0, 0, loc)
+	end := start.AddDate(0, 0, 70)
+
+	s := NewState(time.Wednesday)
+	for i := 0; i < 10; i++ {
+		s.AddPerson(fmt.Sprintf("p%v", i), i)
+	}
+	r := s.Default()
+	r.Cadence = Cadence{Days: 1}
+	msg := solverCmd(command{action: "solver", args: []string{"on", "2h"}}, s)
+	if msg != "The solver can take at most 1m0s, 2h is too long" || r.Solver {
+		t.Fatalf("A limit over MAX_SOLVER_BUDGET shouldn't be accepted, got: %v", msg)
+	}
+	solverCmd(command{action: "solver", args: []string{"on", "10ms"}}, s)
+
+	began := time.Now()
+	sched, warnings := s.BuildRotation(r, start, end, loc)
+	if time.Since(began) > time.Second {
+		t.Fatalf("The solver should have stopped after 10ms, took %v", time.Since(began))
+	}
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "I ran out of time") {
+		t.Fatalf("Expected to run out of time, got: %v", warnings)
+	}
+	for _, name := range workers(sched) {
+		if name == EMPTY_WORKER {
+			t.Fatalf("Every shift should have someone: %v", sched)
+		}
+	}
+}
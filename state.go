@@ -1,22 +1,32 @@
 package main
 
 import (
-	"bufio"
-	"encoding/gob"
 	"errors"
 	"fmt"
-	"os"
-	"sort"
 	"sync"
 	"time"
 )
 
 type State struct {
-	People    map[string]*Person
-	Offset    time.Weekday
-	Schedule  *Schedule
-	StorageID string
-	lock      sync.Mutex
+	// Everyone who is in any rotation
+	People          map[string]*Person
+	Rotations       map[string]*Rotation
+	DefaultRotation string
+	// Where the state is saved, which is up to whoever loads it rather
+	// than saved along with it
+	StorageID string `json:"-"`
+	// Reminders which have been sent, mapped to the start of their shift
+	SentReminders map[string]time.Time
+	// Shifts which have been worked in any rotation, oldest first
+	History []*ShiftRecord
+	// Days which count for more in every rotation, in order
+	Holidays []Holiday
+	changes  changeSet
+	lock     sync.Mutex
+	backend  Store
+	notifier Notifier
+	engine   *Engine
+	audit    *AuditLog
 }
 
 func (s *State) Lock() {
@@ -27,88 +37,133 @@ func (s *State) Unlock() {
 	s.lock.Unlock()
 }
 
-func (s *State) Persist() error {
-	f, err := os.Create(s.StorageID)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	w := bufio.NewWriter(f)
-	enc := gob.NewEncoder(w)
-	err = enc.Encode(s)
-	fmt.Println("Persisting:")
-	fmt.Println(s.Schedule)
-	if err != nil {
-		return err
+// AddPerson adds the named person to the default rotation.
+func (s *State) AddPerson(name string, ordering int) error {
+	if s.Default() == nil {
+		return errors.New("There's no default rotation - set one with rotation default <name>")
 	}
-	w.Flush()
-	return nil
+	return s.AddMember(s.Default(), name, ordering)
 }
 
-func (s *State) Populate() error {
-	f, err := os.Open(s.StorageID)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	r := bufio.NewReader(f)
-	dec := gob.NewDecoder(r)
-	err = dec.Decode(s)
-	if err != nil {
-		fmt.Println("ERROR in populate")
-		return err
-	}
-	fmt.Println("Populating - schedule:")
-	fmt.Println(s.Schedule)
-	return nil
+// BuildSchedule builds a schedule for the default rotation.
+func (s *State) BuildSchedule(start time.Time, end time.Time) *Schedule {
+	sched, _ := s.BuildRotation(s.Default(), start, end, time.Local)
+	return sched
 }
 
-func (s *State) AddPerson(name string, ordering int) error {
-	if _, ok := s.People[name]; ok {
-		return errors.New("We already have a " + name + " please choose a different name")
+// BuildRotation builds a schedule for r which never has anyone working
+// when they're unavailable, gives people r.MinRest shifts off between
+// shifts unless no one else can work, and goes against people's
+// preferences as little as it can. It returns the schedule and a
+// description of each rule or preference it went against, with times
+// shown in loc. It goes through the shifts in order unless r uses the
+// solver. If a shift in r's current schedule is in progress at start, it's
+// kept as it is, so the part of it already worked is still counted when it
+// finishes.
+func (s *State) BuildRotation(r *Rotation, start time.Time, end time.Time, loc *time.Location) (*Schedule, []string) {
+	sched := NewSchedule(start, end, r.ShiftGenerator())
+	if r.Cadence.SkipHolidays {
+		s.moveHandoffs(sched)
+	}
+	kept := r.inProgress(start)
+	if kept != nil {
+		sched.trimBefore(kept.End())
+		defer func() {
+			sched.ShiftsList = append([]*Shift{kept}, sched.ShiftsList...)
+		}()
+	}
+	personList := tempPersonList(r.Members, s.People)
+	warnings := []string{}
+	if len(personList) > 0 && len(personList) <= r.MinRest {
+		warnings = append(warnings, fmt.Sprintf("There aren't enough people in %v for everyone to have %v off between shifts",
+			r.Name, pluralize(r.MinRest, "shift")))
+	}
+	first := start
+	if sched.NumShifts() > 0 {
+		first = sched.ShiftsList[0].Start()
+	}
+	strategy := s.strategy(r, first)
+	recent := s.recentWorkers(r, first, r.MinRest)
+	if kept != nil {
+		for _, p := range personList {
+			if p.Name == kept.Worker().Identifier() {
+				strategy.Worked(personList, p, kept)
+			}
+		}
+	}
+	if r.Solver {
+		weigh := s.weigher(r)
+		worked := s.workedHours(r)
+		if kept != nil {
+			worked[kept.Worker().Identifier()] += time.Duration(float64(kept.End().Sub(kept.Start())) * weigh(kept))
+		}
+		solved, finished := solve(sched, personList, strategy, recent, worked, r.MinRest, r.SolverBudget, weigh)
+		if !finished {
+			warnings = append(warnings, "I ran out of time looking for the best schedule, this is the best one I found")
+		}
+		for _, shift := range sched.ShiftsList {
+			np, ok := solved[shift]
+			name := EMPTY_WORKER
+			if ok {
+				name = np.Name
+				shift.SetWorker(s.People[np.Name])
+				if !rested(np, recent) && len(personList) > r.MinRest {
+					warnings = append(warnings, restWarning(np, shift, r.MinRest, loc))
+				}
+				warnings = append(warnings, preferenceWarnings(personList, np, shift, recent, loc)...)
+			}
+			recent = append(recent, name)
+			if len(recent) > r.MinRest {
+				recent = recent[len(recent)-r.MinRest:]
+			}
+		}
+		return sched, warnings
 	}
-	s.People[name] = NewPerson(name)
-	s.People[name].SetOrdering(ordering)
-	return nil
-}
-
-func (s *State) BuildSchedule(start time.Time, end time.Time) *Schedule {
-	sched := NewSchedule(start, end, s.Offset)
-	personList := tempPersonList(s.People)
 
 	for {
 		cur_shift, err := sched.Next()
 		if err != nil {
 			break
 		}
-		// find person with lowest priority who is available
-		np, err := nextAvailable(personList, cur_shift)
-		if err != nil {
-			continue // worker is already set to empty
-		}
-
-		cur_shift.SetWorker(s.People[np.Name])
-
-		for _, p := range personList {
-			if p.Identifier() != np.Identifier() {
-				p.DecPriority(1)
-			} else {
-				p.IncPriority(len(personList))
+		// find whoever's turn it is who is available
+		strategy.Order(personList, cur_shift)
+		np, err := nextAvailable(personList, cur_shift, recent)
+		// if no one could work it the worker is already set to empty
+		if err == nil {
+			cur_shift.SetWorker(s.People[np.Name])
+			if !rested(np, recent) && len(personList) > r.MinRest {
+				warnings = append(warnings, restWarning(np, cur_shift, r.MinRest, loc))
 			}
+			warnings = append(warnings, preferenceWarnings(personList, np, cur_shift, recent, loc)...)
+			strategy.Worked(personList, np, cur_shift)
+		}
+		recent = append(recent, np.Name)
+		if len(recent) > r.MinRest {
+			recent = recent[len(recent)-r.MinRest:]
 		}
 	}
-	return sched
+	return sched, warnings
 }
 
-func nextAvailable(personList []*Person, cur_shift Shifter) (*Person, error) {
-	sort.Sort(ByPriority(personList))
+// nextAvailable finds the first person in personList who is available,
+// preferring people who didn't work any of the recent shifts, then people
+// who'd like to work cur_shift, and then people who don't mind.
+func nextAvailable(personList []*Person, cur_shift Shifter, recent []string) (*Person, error) {
 	var np *Person
 	found := false
+	best := 0
 	for _, p := range personList {
 		if p.IsAvailable(cur_shift) {
-			np = p
-			found = true
-			break
+			// rest matters more than any preference
+			score := p.PreferenceFor(cur_shift)
+			if rested(p, recent) {
+				score += 3
+			}
+			if !found || score > best {
+				np = p
+				best = score
+				found = true
+			}
 		}
 	}
 	if found {
@@ -118,43 +173,115 @@ func nextAvailable(personList []*Person, cur_shift Shifter) (*Person, error) {
 	}
 }
 
-func tempPersonList(people map[string]*Person) []*Person {
-	personList := make([]*Person, len(people))
+func restWarning(p *Person, shift Shifter, minRest int, loc *time.Location) string {
+	return fmt.Sprintf("%v had to work %v to %v without %v off first, no one else could",
+		p.Identifier(), shift.Start().In(loc).Format(TIME_FORMAT), shift.End().In(loc).Format(TIME_FORMAT),
+		pluralize(minRest, "shift"))
+}
+
+// rested returns whether p didn't work any of the recent shifts.
+func rested(p *Person, recent []string) bool {
+	for _, name := range recent {
+		if name == p.Name {
+			return false
+		}
+	}
+	return true
+}
+
+// recentWorkers returns who worked the last n shifts in r's current
+// schedule ending by start, oldest first.
+func (s *State) recentWorkers(r *Rotation, start time.Time, n int) []string {
+	recent := []string{}
+	if r.Schedule == nil {
+		return recent
+	}
+	for _, shift := range r.Schedule.ShiftsList {
+		if shift.End().After(start) {
+			break
+		}
+		recent = append(recent, shift.Worker().Identifier())
+	}
+	if len(recent) > n {
+		recent = recent[len(recent)-n:]
+	}
+	return recent
+}
+
+func pluralize(n int, thing string) string {
+	if n == 1 {
+		return fmt.Sprintf("%v %v", n, thing)
+	}
+	return fmt.Sprintf("%v %vs", n, thing)
+}
+
+// tempPersonList returns a copy of each member of a rotation, with their
+// priority in the rotation, which can be changed while building a schedule.
+func tempPersonList(members map[string]*Member, people map[string]*Person) []*Person {
+	personList := make([]*Person, len(members))
 	i := 0
-	for _, p := range people {
-		personList[i] = &Person{}
-		personList[i].Name = p.Name
-		personList[i].Unavailability = p.Unavailability
-		personList[i].PriorityNum = p.PriorityNum
-		personList[i].OrderNum = p.OrderNum
+	for _, m := range members {
+		p := *people[m.Name]
+		personList[i] = &p
+		personList[i].PriorityNum = m.PriorityNum
+		personList[i].OrderNum = m.OrderNum
 		i += 1
 	}
 	return personList
 }
 
-func NewState(offset time.Weekday) State {
+// pruneUnavailability forgets unavailabilities and preferences which are
+// over by now, and returns whether there were any.
+func (s *State) pruneUnavailability(now time.Time) bool {
+	pruned := false
+	for name, p := range s.People {
+		// both, so one doesn't stop the other
+		unavailability, preferences := p.PruneUnavailable(now), p.PrunePreferences(now)
+		if unavailability || preferences {
+			s.personChanged(name)
+			pruned = true
+		}
+	}
+	return pruned
+}
+
+// requester returns the person who issued cc, if they're someone sked
+// schedules.
+func (s *State) requester(cc command) (*Person, bool) {
+	if cc.user == "" {
+		return nil, false
+	}
+	for _, p := range s.People {
+		if p.SlackUser() == cc.user {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// zone returns the time zone the dates in cc are in, and that the response
+// to it should show times in.
+func (s *State) zone(cc command) *time.Location {
+	if p, ok := s.requester(cc); ok {
+		return p.Location()
+	}
+	return time.Local
+}
+
+// now is when cc was issued, in its requester's time zone.
+func (s *State) now(cc command) time.Time {
+	return cc.now().In(s.zone(cc))
+}
+
+func NewState(offset time.Weekday) *State {
 	// Wednesday is the default for offset... makes sense right?
-	s := State{
-		People:    make(map[string]*Person),
-		Offset:    offset,
-		StorageID: "skedState.gob",
+	s := &State{
+		People:          make(map[string]*Person),
+		Rotations:       make(map[string]*Rotation),
+		DefaultRotation: DEFAULT_ROTATION,
+		StorageID:       DEFAULT_STORAGE_ID,
+		SentReminders:   make(map[string]time.Time),
 	}
+	s.Rotations[DEFAULT_ROTATION] = NewRotation(DEFAULT_ROTATION, offset)
 	return s
 }
-
-// func checkSchedule(s state) {
-// 	if len(s.schedule) == 0 {
-// 		return
-// 	}
-// 	now := time.Now()
-// 	if now.After(s.schedule[0].End()) {
-// 		curWorker = s.schedule[0].Worker()
-// 		for n, p := range s.people {
-// 			if p.Identifier() != curWorker.Identifier() {
-// 				p.DecPriority(1)
-// 			} else {
-// 				p.IncPriority(len(s.people))
-// 			}
-// 		}
-// 	}
-// }
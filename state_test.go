@@ -1,6 +1,8 @@
 package main
 
 import (
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -10,6 +12,114 @@ func TestPersist(t *testing.T) {
 	loc, _ := time.LoadLocation("America/Chicago")
 	start := time.Date(2015, time.October, 11, 22, 0, 0, 0, loc)
 	end := time.Date(2015, time.November, 18, 17, 0, 0, 0, loc)
+	s.StorageID = filepath.Join(t.TempDir(), "skedState.json")
 	s.BuildSchedule(start, end)
 	s.Persist()
 }
+
+func TestPreferences(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, time.October, 11, 22, 0, 0, 0, loc)
+	end := time.Date(2015, time.November, 18, 17, 0, 0, 0, loc)
+	day := func(d int) *Interval {
+		return &Interval{time.Date(2015, time.October, d, 0, 0, 0, 0, loc), time.Date(2015, time.October, d+1, 0, 0, 0, 0, loc)}
+	}
+	worker := func(sched *Schedule, d int) string {
+		shift, _ := sched.GetShift(day(d).Start().Add(time.Hour))
+		return shift.Worker().Identifier()
+	}
+
+	s := NewState(time.Wednesday)
+	s.AddPerson("joe", 0)
+	s.AddPerson("bob", 1)
+	s.AddPerson("sue", 2)
+	sched, warnings := s.BuildRotation(s.Default(), start, end, loc)
+	if worker(sched, 15) != "bob" || worker(sched, 22) != "sue" || len(warnings) != 0 {
+		t.Fatalf("Unexpected schedule: %v, %v", sched, warnings)
+	}
+
+	// sue would like bob's shift, and bob would rather not work it
+	s.People["sue"].AddPreference(day(15), true)
+	s.People["bob"].AddPreference(day(16), false)
+	sched, warnings = s.BuildRotation(s.Default(), start, end, loc)
+	if worker(sched, 15) != "sue" || worker(sched, 22) != "bob" || len(warnings) != 0 {
+		t.Fatalf("sue should have taken bob's shift: %v, %v", sched, warnings)
+	}
+
+	// no one else can work when bob would rather not
+	s.People["sue"].AddUnavailable(day(17))
+	s.People["joe"].AddUnavailable(day(17))
+	s.People["joe"].AddPreference(day(18), true)
+	sched, warnings = s.BuildRotation(s.Default(), start, end, loc)
+	if worker(sched, 15) != "bob" {
+		t.Fatalf("bob should have had to work: %v", sched)
+	}
+	expected := []string{
+		"bob would rather not work Wed Oct 14 00:00 CDT to Wed Oct 21 00:00 CDT, but no one else could",
+	}
+	if len(warnings) != len(expected) || warnings[0] != expected[0] {
+		t.Fatalf("Expected warnings %v, got: %v", expected, warnings)
+	}
+	london, _ := time.LoadLocation("Europe/London")
+	_, warnings = s.BuildRotation(s.Default(), start, end, london)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "Wed Oct 14 06:00 BST to Wed Oct 21 06:00 BST") {
+		t.Fatalf("The warnings should be in London time, got: %v", warnings)
+	}
+	// joe and sue could work the 16th, but not without a rest
+	people := []*Person{s.People["bob"], s.People["joe"], s.People["sue"]}
+	if because := overriddenBecause(people, s.People["bob"], day(16), []string{"joe", "sue"}); because != "everyone else who could needed a rest" {
+		t.Fatalf("Unexpected reason for going against bob's preference: %v", because)
+	}
+
+	if s.People["bob"].PrunePreferences(day(16).Start()) || !s.People["bob"].PrunePreferences(day(16).End()) {
+		t.Fatalf("bob's preference should be pruned once it's over")
+	}
+	id := s.People["sue"].Preferences[0].ID
+	if !s.People["sue"].RemovePreference(id) || s.People["sue"].RemovePreference(id) {
+		t.Fatalf("sue's preference should have been removed once")
+	}
+}
+
+func TestMinRest(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, time.October, 11, 22, 0, 0, 0, loc)
+	end := time.Date(2015, time.November, 18, 17, 0, 0, 0, loc)
+
+	s := NewState(time.Wednesday)
+	s.AddPerson("joe", 0)
+	s.AddPerson("bob", 1)
+	s.AddPerson("sue", 2)
+	// the priority strategy gives each shift to whoever has the lowest
+	// priority, so at -10 joe would work several shifts in a row if they
+	// didn't need a rest
+	s.Default().Members["joe"].PriorityNum = -10
+	restCmd(command{action: "rest", args: []string{"2"}}, s)
+	sched, warnings := s.BuildRotation(s.Default(), start, end, loc)
+	for i, shift := range sched.ShiftsList[2:] {
+		for _, prev := range sched.ShiftsList[i : i+2] {
+			if prev.Worker().Identifier() == shift.Worker().Identifier() {
+				t.Fatalf("Everyone should have 2 shifts off between shifts: %v", sched)
+			}
+		}
+	}
+	if len(warnings) != 0 {
+		t.Fatalf("Unexpected warnings: %v", warnings)
+	}
+
+	// sue can't work the shift after joe's first, and bob can't work any
+	bob, _ := NewInterval(start.AddDate(0, 0, -7), end)
+	s.People["bob"].AddUnavailable(bob)
+	sue, _ := NewInterval(time.Date(2015, time.October, 15, 0, 0, 0, 0, loc), time.Date(2015, time.October, 16, 0, 0, 0, 0, loc))
+	s.People["sue"].AddUnavailable(sue)
+	sched, warnings = s.BuildRotation(s.Default(), start, end, loc)
+	second, _ := sched.GetShift(time.Date(2015, time.October, 15, 0, 0, 0, 0, loc))
+	if second.Worker().Identifier() != "joe" || len(warnings) == 0 ||
+		warnings[0] != "joe had to work Wed Oct 14 00:00 CDT to Wed Oct 21 00:00 CDT without 2 shifts off first, no one else could" {
+		t.Fatalf("joe should have had to work back to back: %v, %v", sched, warnings)
+	}
+	london, _ := time.LoadLocation("Europe/London")
+	_, warnings = s.BuildRotation(s.Default(), start, end, london)
+	if len(warnings) == 0 || !strings.HasPrefix(warnings[0], "joe had to work Wed Oct 14 06:00 BST to Wed Oct 21 06:00 BST") {
+		t.Fatalf("The warnings should be in London time, got: %v", warnings)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Where the state is saved unless told otherwise
+const DEFAULT_STORAGE_ID = "skedState.json"
+
+// The version of the format Persist writes. Bump it whenever a change to
+// State or anything in it would stop an older file from loading as it
+// should, and add a migration to stateMigrations.
+const STATE_VERSION = 1
+
+// stateMigrations upgrade a saved state from the version they're keyed by
+// to the next one. They work on the state as plain JSON values, so they
+// can rename or reshape fields before it's decoded into a State.
+var stateMigrations = map[int]func(state map[string]interface{}) error{}
+
+// A Store is somewhere a State is saved between runs.
+type Store interface {
+	// Save writes out s, or at least what's been marked as changed in
+	// it, and forgets what's been marked.
+	Save(s *State) error
+
+	// Load replaces what's in s with what was last saved.
+	Load(s *State) error
+
+	Close() error
+}
+
+// store returns where s is saved, the JSON file at s.StorageID unless it's
+// been given another.
+func (s *State) store() Store {
+	if s.backend == nil {
+		return fileStore{}
+	}
+	return s.backend
+}
+
+// SetStore makes s save to and load from store.
+func (s *State) SetStore(store Store) {
+	s.backend = store
+}
+
+// Persist saves s to its store.
+func (s *State) Persist() error {
+	return s.store().Save(s)
+}
+
+// Populate loads s from its store.
+func (s *State) Populate() error {
+	return s.store().Load(s)
+}
+
+// A fileStore saves the whole state as a snapshot in the JSON file at the
+// state's StorageID.
+type fileStore struct{}
+
+// A stateDocument is what's saved on disk - the state, and the version of
+// the format it's in.
+type stateDocument struct {
+	Version int             `json:"version"`
+	State   json.RawMessage `json:"state"`
+}
+
+// Save writes s as JSON to s.StorageID. It writes to a temporary file and
+// renames it over the old one, so a crash part way through leaves the old
+// state rather than half of the new one.
+func (fileStore) Save(s *State) error {
+	state, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(stateDocument{Version: STATE_VERSION, State: state}, "", "  ")
+	if err != nil {
+		return err
+	}
+	log.Println("Persisting:")
+	for _, r := range s.Rotations {
+		log.Println(r.Name, r.Schedule)
+	}
+	if err := writeFileAtomic(s.StorageID, append(data, '\n')); err != nil {
+		return err
+	}
+	s.saved()
+	return nil
+}
+
+// writeFileAtomic replaces filename with data, or leaves it as it was if
+// anything goes wrong.
+func writeFileAtomic(filename string, data []byte) error {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := ioutil.TempFile(dir, base+".tmp")
+	if err != nil {
+		return err
+	}
+	// does nothing once it's been renamed
+	defer os.Remove(f.Name())
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// Load loads s from s.StorageID. If that's a gob file from an older sked,
+// or it doesn't exist but there's a gob file of the same name next to it,
+// s is loaded from that instead and will be saved as JSON the next time
+// it's persisted.
+func (fileStore) Load(s *State) error {
+	data, err := ioutil.ReadFile(s.StorageID)
+	if os.IsNotExist(err) && strings.HasSuffix(s.StorageID, ".json") {
+		legacy := strings.TrimSuffix(s.StorageID, ".json") + ".gob"
+		if legacyData, legacyErr := ioutil.ReadFile(legacy); legacyErr == nil {
+			data, err = legacyData, nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		err = s.decodeJSON(data)
+	} else {
+		err = s.decodeGob(data)
+	}
+	if err != nil {
+		log.Println("ERROR in populate")
+		return err
+	}
+	s.relink()
+	s.saved()
+	log.Println("Populating - schedule:")
+	for _, r := range s.Rotations {
+		log.Println(r.Name, r.Schedule)
+	}
+	return nil
+}
+
+func (fileStore) Close() error {
+	return nil
+}
+
+func (s *State) decodeJSON(data []byte) error {
+	doc := stateDocument{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	return s.decodeState(doc.Version, doc.State)
+}
+
+// decodeState loads s from state, which is in the given version of the
+// format, upgrading it with stateMigrations first if it's older.
+func (s *State) decodeState(version int, state json.RawMessage) error {
+	if version > STATE_VERSION {
+		return fmt.Errorf("The state is version %v, but this sked only understands up to version %v", version, STATE_VERSION)
+	}
+	for ; version < STATE_VERSION; version++ {
+		migration, ok := stateMigrations[version]
+		if !ok {
+			return fmt.Errorf("There's no way to upgrade the state from version %v", version)
+		}
+		values := make(map[string]interface{})
+		if err := json.Unmarshal(state, &values); err != nil {
+			return err
+		}
+		if err := migration(values); err != nil {
+			return fmt.Errorf("Couldn't upgrade the state from version %v: %v", version, err)
+		}
+		var err error
+		if state, err = json.Marshal(values); err != nil {
+			return err
+		}
+	}
+	// decoding into a map adds to what's already in it
+	s.People, s.Rotations, s.SentReminders = nil, nil, nil
+	storageID := s.StorageID
+	defer func() { s.StorageID = storageID }()
+	if err := json.Unmarshal(state, s); err != nil {
+		return err
+	}
+	if s.People == nil {
+		s.People = make(map[string]*Person)
+	}
+	if s.Rotations == nil {
+		s.Rotations = make(map[string]*Rotation)
+	}
+	if s.SentReminders == nil {
+		s.SentReminders = make(map[string]time.Time)
+	}
+	return nil
+}
+
+// decodeGob loads a state saved by a sked from before states were saved
+// as JSON, including from before there were rotations. The StorageID saved
+// in it is ignored, so the state is saved as JSON where it was loaded from.
+func (s *State) decodeGob(data []byte) error {
+	s.Rotations = nil
+	storageID := s.StorageID
+	defer func() { s.StorageID = storageID }()
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(s)
+	if err != nil {
+		return err
+	}
+	if s.Rotations == nil {
+		// saved before there were rotations
+		var old legacyState
+		err = gob.NewDecoder(bytes.NewReader(data)).Decode(&old)
+		if err != nil {
+			return err
+		}
+		if len(old.People) > 0 || old.Schedule != nil {
+			s.migrate(old)
+		} else {
+			s.Rotations = make(map[string]*Rotation)
+		}
+	}
+	return nil
+}
+
+// relink points the shifts in each schedule at the people in s.People,
+// rather than the copies of them that were saved along with the shifts,
+// and numbers anything saved before it had an ID.
+func (s *State) relink() {
+	for _, p := range s.People {
+		p.fillIDs()
+	}
+	for _, r := range s.Rotations {
+		if r.Schedule == nil {
+			continue
+		}
+		for _, shift := range r.Schedule.ShiftsList {
+			if shift.Worker() == nil {
+				shift.SetWorker(NewPerson(EMPTY_WORKER))
+			} else if p, ok := s.People[shift.Worker().Identifier()]; ok {
+				shift.SetWorker(p)
+			}
+		}
+	}
+}
+
+// UnmarshalJSON decodes a Person, whose unavailability is a list of
+// Unavailables rather than any kind of Intervaler.
+func (p *Person) UnmarshalJSON(data []byte) error {
+	type person Person
+	aux := struct {
+		*person
+		Unavailability []*Unavailable
+	}{person: (*person)(p)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	p.Unavailability = nil
+	for _, unavailable := range aux.Unavailability {
+		p.Unavailability = append(p.Unavailability, unavailable)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, time.October, 11, 22, 0, 0, 0, loc)
+	end := time.Date(2015, time.November, 18, 17, 0, 0, 0, loc)
+	dir := t.TempDir()
+
+	s := NewState(time.Wednesday)
+	s.StorageID = filepath.Join(dir, "skedState.json")
+	s.AddPerson("joe", 0)
+	s.AddPerson("bob", 1)
+	s.People["bob"].TZ = "Europe/London"
+	s.People["bob"].AddUnavailable(&Interval{start, start.Add(time.Hour * 24)})
+	recurrence, _ := ParseRecurrence([]string{"2nd", "monday"})
+	s.People["bob"].AddRecurring(recurrence)
+	s.People["joe"].AddPreference(&Interval{start, start.Add(time.Hour)}, true)
+	s.AddHoliday(start, "Some holiday")
+	s.Default().Schedule = s.BuildSchedule(start, end)
+	s.CommitShifts(start.AddDate(0, 0, 10))
+	if err := s.Persist(); err != nil {
+		t.Fatalf("Couldn't persist: %v", err)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("Only the state should be left behind, found %v files", len(files))
+	}
+	data, _ := ioutil.ReadFile(s.StorageID)
+	if !bytes.HasPrefix(data, []byte("{\n  \"version\": 1,")) {
+		t.Fatalf("The state should say its version:\n%s", data[:40])
+	}
+
+	loaded := NewState(time.Monday)
+	loaded.StorageID = s.StorageID
+	if err := loaded.Populate(); err != nil {
+		t.Fatalf("Couldn't populate: %v", err)
+	}
+	if !bytes.Equal(s.digest(), loaded.digest()) {
+		t.Fatalf("The state changed on the way through:\n%s\n%s", s.digest(), loaded.digest())
+	}
+	if !loaded.People["bob"].IsAvailable(&Interval{end, end.Add(time.Hour)}) ||
+		loaded.People["bob"].IsAvailable(&Interval{start, start.Add(time.Hour)}) {
+		t.Fatalf("bob's unavailability wasn't loaded properly: %v", loaded.People["bob"].Unavailability)
+	}
+	shift := loaded.Default().Schedule.ShiftsList[0]
+	if shift.Worker() != loaded.People[shift.Worker().Identifier()] {
+		t.Fatalf("Shifts should be worked by the people in the state, not copies")
+	}
+}
+
+func TestStoreVersions(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "skedState.json")
+	s := NewState(time.Wednesday)
+	s.StorageID = filename
+
+	ioutil.WriteFile(filename, []byte(`{"version": 2, "state": {}}`), 0644)
+	if err := s.Populate(); err == nil || !strings.Contains(err.Error(), "version 2") {
+		t.Fatalf("A newer state shouldn't load, got: %v", err)
+	}
+
+	// a made up version 0 which called rotations "Lists"
+	ioutil.WriteFile(filename, []byte(`{"version": 0, "state": {"Lists": {"ops": {"Name": "ops"}}, "DefaultRotation": "ops"}}`), 0644)
+	if err := s.Populate(); err == nil {
+		t.Fatalf("There's no migration from version 0")
+	}
+	stateMigrations[0] = func(state map[string]interface{}) error {
+		state["Rotations"] = state["Lists"]
+		delete(state, "Lists")
+		return nil
+	}
+	defer delete(stateMigrations, 0)
+	if err := s.Populate(); err != nil {
+		t.Fatalf("Couldn't populate: %v", err)
+	}
+	if s.Default() == nil || s.Default().Name != "ops" {
+		t.Fatalf("Expected the ops rotation, got: %v", s.RotationNames())
+	}
+
+	// saved before unavailabilities had IDs
+	ioutil.WriteFile(filename, []byte(`{"version": 1, "state": {"People": {"joe": {"Name": "joe",
+		"Unavailability": [{"StartTime": "2015-10-11T00:00:00Z", "EndTime": "2015-10-12T00:00:00Z"}]}}}}`), 0644)
+	if err := s.Populate(); err != nil {
+		t.Fatalf("Couldn't populate: %v", err)
+	}
+	if u := s.People["joe"].Unavailability[0].(*Unavailable); u.ID != 1 || s.People["joe"].LastID != 1 {
+		t.Fatalf("joe's unavailability should have been given an ID: %v", u)
+	}
+}
+
+func TestStoreFromGob(t *testing.T) {
+	dir := t.TempDir()
+	old := NewState(time.Wednesday)
+	old.AddPerson("joe", 0)
+	old.Default().Channel = "C123"
+	f, err := os.Create(filepath.Join(dir, "skedState.gob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = gob.NewEncoder(f).Encode(old)
+	f.Close()
+	if err != nil {
+		t.Fatalf("Couldn't write state file: %v", err)
+	}
+
+	s := NewState(time.Wednesday)
+	s.StorageID = filepath.Join(dir, DEFAULT_STORAGE_ID)
+	if err := s.Populate(); err != nil {
+		t.Fatalf("Couldn't populate from the gob file: %v", err)
+	}
+	if s.People["joe"] == nil || s.Default().Channel != "C123" {
+		t.Fatalf("The gob file wasn't loaded properly: %v", s.Default())
+	}
+	if s.StorageID != filepath.Join(dir, DEFAULT_STORAGE_ID) {
+		t.Fatalf("The state should still be saved where it was loaded from, not %v", s.StorageID)
+	}
+	if err := s.Persist(); err != nil {
+		t.Fatalf("Couldn't persist: %v", err)
+	}
+	data, err := ioutil.ReadFile(s.StorageID)
+	if err != nil || !bytes.HasPrefix(data, []byte("{")) {
+		t.Fatalf("The state should have been written as JSON next to the gob file: %v", err)
+	}
+	loaded := NewState(time.Wednesday)
+	loaded.StorageID = s.StorageID
+	if err := loaded.Populate(); err != nil || loaded.People["joe"] == nil {
+		t.Fatalf("Couldn't load the state back as JSON: %v", err)
+	}
+}
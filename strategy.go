@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The strategies a rotation can use, the first is the default
+var STRATEGIES = []string{"priority", "round-robin", "least-hours", "random"}
+
+// A Strategy decides whose turn it is to work while a schedule is being
+// built. BuildRotation gives each shift to the first person in the order
+// who is available, after accounting for rest and preferences.
+type Strategy interface {
+	// Order sorts people so that whoever should work shift comes first.
+	Order(people []*Person, shift Shifter)
+
+	// Worked records that worker was given shift.
+	Worked(people []*Person, worker *Person, shift Shifter)
+}
+
+// strategy returns a new instance of r's strategy for building a schedule
+// whose first shift starts at start.
+func (s *State) strategy(r *Rotation, start time.Time) Strategy {
+	weigh := s.weigher(r)
+	switch r.Strategy {
+	case "round-robin":
+		rr := &roundRobinStrategy{}
+		if recent := s.recentWorkers(r, start, 1); len(recent) > 0 {
+			rr.last = recent[0]
+		}
+		return rr
+	case "least-hours":
+		return &leastHoursStrategy{hours: s.workedHours(r), weigh: weigh}
+	case "random":
+		return &randomStrategy{rand: rand.New(rand.NewSource(r.Seed))}
+	}
+	return priorityStrategy{weigh: weigh}
+}
+
+// workedHours returns the weighted hours each person has worked in r, by
+// name, from the history.
+func (s *State) workedHours(r *Rotation) map[string]time.Duration {
+	hours := make(map[string]time.Duration)
+	for _, record := range s.History {
+		if record.Rotation == r.Name {
+			hours[record.Worker] += time.Duration(float64(record.End().Sub(record.Start())) * record.weight())
+		}
+	}
+	return hours
+}
+
+// priorityStrategy gives the shift to whoever has the lowest priority.
+// Working a shift increases someone's priority by the number of people
+// times the shift's weight, and everyone else's goes down by 1, so
+// whoever has worked least recently goes next, and someone who works a
+// holiday waits longer for their next turn.
+type priorityStrategy struct {
+	weigh func(Intervaler) float64
+}
+
+func (ps priorityStrategy) Order(people []*Person, shift Shifter) {
+	sort.Sort(ByPriority(people))
+}
+
+func (ps priorityStrategy) Worked(people []*Person, worker *Person, shift Shifter) {
+	for _, p := range people {
+		if p.Identifier() != worker.Identifier() {
+			p.DecPriority(1)
+		} else {
+			p.IncPriority(weightedPriority(len(people), ps.weigh(shift)))
+		}
+	}
+}
+
+// weightedPriority is how much someone's priority goes up for working a
+// shift with weight in a rotation with n people.
+func weightedPriority(n int, weight float64) int {
+	return int(math.Round(float64(n) * weight))
+}
+
+// roundRobinStrategy goes through people strictly in order of their
+// OrderNum, starting after whoever worked last.
+type roundRobinStrategy struct {
+	last string
+}
+
+func (rr *roundRobinStrategy) Order(people []*Person, shift Shifter) {
+	sort.Slice(people, func(i, j int) bool {
+		if people[i].Ordering() == people[j].Ordering() {
+			return people[i].Identifier() < people[j].Identifier()
+		}
+		return people[i].Ordering() < people[j].Ordering()
+	})
+	for i, p := range people {
+		if p.Identifier() == rr.last {
+			rotated := append(append([]*Person{}, people[i+1:]...), people[:i+1]...)
+			copy(people, rotated)
+			return
+		}
+	}
+}
+
+func (rr *roundRobinStrategy) Worked(people []*Person, worker *Person, shift Shifter) {
+	rr.last = worker.Identifier()
+}
+
+// leastHoursStrategy gives the shift to whoever has worked the fewest
+// weighted hours in the rotation, counting the history and the schedule
+// so far.
+type leastHoursStrategy struct {
+	hours map[string]time.Duration
+	weigh func(Intervaler) float64
+}
+
+func (lh *leastHoursStrategy) Order(people []*Person, shift Shifter) {
+	sort.Sort(ByPriority(people))
+	sort.SliceStable(people, func(i, j int) bool {
+		return lh.hours[people[i].Identifier()] < lh.hours[people[j].Identifier()]
+	})
+}
+
+func (lh *leastHoursStrategy) Worked(people []*Person, worker *Person, shift Shifter) {
+	lh.hours[worker.Identifier()] += time.Duration(float64(shift.End().Sub(shift.Start())) * lh.weigh(shift))
+}
+
+// randomStrategy gives the shift to someone at random. The same seed
+// always builds the same schedule.
+type randomStrategy struct {
+	rand *rand.Rand
+}
+
+func (rs *randomStrategy) Order(people []*Person, shift Shifter) {
+	sort.Slice(people, func(i, j int) bool {
+		return people[i].Identifier() < people[j].Identifier()
+	})
+	rs.rand.Shuffle(len(people), func(i, j int) {
+		people[i], people[j] = people[j], people[i]
+	})
+}
+
+func (rs *randomStrategy) Worked(people []*Person, worker *Person, shift Shifter) {}
+
+// parseStrategy checks that name is one of the STRATEGIES.
+func parseStrategy(name string) (string, error) {
+	for _, strategy := range STRATEGIES {
+		if name == strategy {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("I don't know the strategy %v, try one of %v", name, strings.Join(STRATEGIES, ", "))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func workers(sched *Schedule) []string {
+	names := make([]string, sched.NumShifts())
+	for i, shift := range sched.ShiftsList {
+		names[i] = shift.Worker().Identifier()
+	}
+	return names
+}
+
+func TestStrategies(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, time.October, 11, 22, 0, 0, 0, loc)
+	end := time.Date(2015, time.November, 18, 17, 0, 0, 0, loc)
+
+	s := NewState(time.Wednesday)
+	s.AddPerson("joe", 2)
+	s.AddPerson("bob", 0)
+	s.AddPerson("sue", 1)
+	r := s.Default()
+	r.Members["sue"].PriorityNum = 10
+
+	msg := strategyCmd(command{action: "strategy", args: []string{"fair"}}, s)
+	if msg != "I don't know the strategy fair, try one of priority, round-robin, least-hours, random" {
+		t.Fatalf("Unexpected response from strategy: %v", msg)
+	}
+
+	// sue's high priority doesn't matter in round robin
+	strategyCmd(command{action: "strategy", args: []string{"round-robin"}}, s)
+	r.Schedule, _ = s.BuildRotation(r, start, end, loc)
+	expected := "bob sue joe bob sue joe bob"
+	if got := strings.Join(workers(r.Schedule), " "); got != expected {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+	// and rebuilding picks up after whoever worked last
+	r.Schedule, _ = s.BuildRotation(r, r.Schedule.ShiftsList[2].Start().Add(time.Hour), end, loc)
+	if got := strings.Join(workers(r.Schedule), " "); got != "joe bob sue joe bob" {
+		t.Fatalf("Expected to start after sue, got %v", got)
+	}
+
+	// bob has worked the most hours
+	r.Schedule = nil
+	s.History = []*ShiftRecord{{StartTime: start.AddDate(0, 0, -30), EndTime: start, Worker: "bob", Rotation: r.Name}}
+	strategyCmd(command{action: "strategy", args: []string{"least-hours"}}, s)
+	r.Schedule, _ = s.BuildRotation(r, start, end, loc)
+	if got := strings.Join(workers(r.Schedule), " "); got != "joe sue joe sue joe sue joe" {
+		t.Fatalf("bob shouldn't work until they've caught up, got %v", got)
+	}
+
+	strategyCmd(command{action: "strategy", args: []string{"random", "42"}}, s)
+	first, _ := s.BuildRotation(r, start, end, loc)
+	second, _ := s.BuildRotation(r, start, end, loc)
+	if strings.Join(workers(first), " ") != strings.Join(workers(second), " ") {
+		t.Fatalf("The same seed should build the same schedule: %v, %v", first, second)
+	}
+	if msg := strategyCmd(command{action: "strategy"}, s); msg != "support uses the random strategy" {
+		t.Fatalf("Unexpected response from strategy: %v", msg)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// How much more an hour on a weekend or holiday counts than any other hour,
+// unless a rotation says otherwise
+const (
+	DEFAULT_WEEKEND_WEIGHT = 1.5
+	DEFAULT_HOLIDAY_WEIGHT = 2.0
+)
+
+// A Holiday is a day which counts for more when working out whose turn it
+// is, so that holiday coverage goes around fairly.
+type Holiday struct {
+	// Midnight at the start of the day
+	Date time.Time
+	Name string
+}
+
+func (h Holiday) String() string {
+	if h.Name == "" {
+		return h.Date.Format("Mon Jan 2 2006")
+	}
+	return fmt.Sprintf("%v %v", h.Date.Format("Mon Jan 2 2006"), h.Name)
+}
+
+// AddHoliday adds or renames the holiday on date's day.
+func (s *State) AddHoliday(date time.Time, name string) {
+	date = atMidnight(date)
+	for i, h := range s.Holidays {
+		if sameDay(h.Date, date) {
+			s.Holidays[i].Name = name
+			s.otherChanged()
+			return
+		}
+	}
+	s.Holidays = append(s.Holidays, Holiday{date, name})
+	s.otherChanged()
+	sort.Slice(s.Holidays, func(i, j int) bool {
+		return s.Holidays[i].Date.Before(s.Holidays[j].Date)
+	})
+}
+
+// RemoveHoliday removes the holiday on date's day, and returns whether
+// there was one.
+func (s *State) RemoveHoliday(date time.Time) bool {
+	for i, h := range s.Holidays {
+		if sameDay(h.Date, date) {
+			s.Holidays = append(s.Holidays[:i], s.Holidays[i+1:]...)
+			s.otherChanged()
+			return true
+		}
+	}
+	return false
+}
+
+// holiday returns the holiday on day, if there is one. Holidays are whole
+// calendar days wherever day is.
+func (s *State) holiday(day time.Time) (Holiday, bool) {
+	for _, h := range s.Holidays {
+		if sameDay(h.Date, day) {
+			return h, true
+		}
+	}
+	return Holiday{}, false
+}
+
+func sameDay(a time.Time, b time.Time) bool {
+	return a.Year() == b.Year() && a.Month() == b.Month() && a.Day() == b.Day()
+}
+
+// Weights returns how much more an hour on a weekend and on a holiday
+// count in r than any other hour.
+func (r *Rotation) Weights() (weekend float64, holiday float64) {
+	weekend, holiday = r.WeekendWeight, r.HolidayWeight
+	if weekend == 0 {
+		weekend = DEFAULT_WEEKEND_WEIGHT
+	}
+	if holiday == 0 {
+		holiday = DEFAULT_HOLIDAY_WEIGHT
+	}
+	return weekend, holiday
+}
+
+// weigher returns a function that weighs intervals in r - the average of
+// how much each hour in the interval counts, so a shift with no weekend or
+// holiday hours weighs 1.
+func (s *State) weigher(r *Rotation) func(Intervaler) float64 {
+	weekend, holiday := r.Weights()
+	return func(i Intervaler) float64 {
+		total := i.End().Sub(i.Start())
+		if total <= 0 {
+			return 1
+		}
+		var weighted float64
+		for day := atMidnight(i.Start()); day.Before(i.End()); day = day.AddDate(0, 0, 1) {
+			start, end := day, day.AddDate(0, 0, 1)
+			if start.Before(i.Start()) {
+				start = i.Start()
+			}
+			if end.After(i.End()) {
+				end = i.End()
+			}
+			weight := 1.0
+			if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+				weight = math.Max(weight, weekend)
+			}
+			if _, ok := s.holiday(day); ok {
+				weight = math.Max(weight, holiday)
+			}
+			weighted += float64(end.Sub(start)) * weight
+		}
+		return weighted / float64(total)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestWeigher(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	day := func(d int, h int) time.Time {
+		// October 17 2015 is a Saturday
+		return time.Date(2015, time.October, d, h, 0, 0, 0, loc)
+	}
+	s := NewState(time.Wednesday)
+	r := s.Default()
+	s.AddHoliday(day(19, 15), "Some holiday")
+	weigh := s.weigher(r)
+
+	tests := []struct {
+		start  time.Time
+		end    time.Time
+		weight float64
+	}{
+		{day(15, 0), day(16, 0), 1},
+		{day(17, 0), day(19, 0), DEFAULT_WEEKEND_WEIGHT},
+		{day(19, 0), day(20, 0), DEFAULT_HOLIDAY_WEIGHT},
+		// half on friday, half on saturday
+		{day(16, 12), day(17, 12), (1 + DEFAULT_WEEKEND_WEIGHT) / 2},
+		{day(14, 0), day(21, 0), (4 + 2*DEFAULT_WEEKEND_WEIGHT + DEFAULT_HOLIDAY_WEIGHT) / 7},
+	}
+	for _, test := range tests {
+		i, _ := NewInterval(test.start, test.end)
+		if weight := weigh(i); math.Abs(weight-test.weight) > 1e-9 {
+			t.Fatalf("%v should weigh %v, not %v", i, test.weight, weight)
+		}
+	}
+
+	weightsCmd(command{action: "weights", args: []string{"weekend", "1", "holiday", "3"}}, s)
+	i, _ := NewInterval(day(18, 0), day(20, 0))
+	if weight := s.weigher(r)(i); weight != 2 {
+		t.Fatalf("%v should weigh 2, not %v", i, weight)
+	}
+}
+
+func TestHolidayFairness(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, time.December, 21, 12, 0, 0, 0, loc)
+	end := start.AddDate(0, 0, 20)
+	s := NewState(time.Wednesday)
+	s.AddPerson("joe", 0)
+	s.AddPerson("bob", 1)
+	s.AddPerson("sue", 2)
+	r := s.Default()
+	r.Cadence = Cadence{Days: 1}
+	weightsCmd(command{action: "weights", args: []string{"weekend", "1", "holiday", "3"}}, s)
+
+	msg := holidayCmd(command{action: "holiday", args: []string{"add", "2015-12-25", "Christmas"}}, s)
+	if msg != "Added the holiday Fri Dec 25 2015 Christmas - build to apply it to the schedule" {
+		t.Fatalf("Unexpected response from holiday: %v", msg)
+	}
+	sched, _ := s.BuildRotation(r, start, end, loc)
+	christmas, _ := sched.GetShift(time.Date(2015, time.December, 25, 12, 0, 0, 0, loc))
+	worker := christmas.Worker().Identifier()
+	next := christmas.End()
+	for _, shift := range sched.ShiftsList {
+		if shift.Start().After(christmas.Start()) && shift.Worker().Identifier() == worker {
+			next = shift.Start()
+			break
+		}
+	}
+	// with 3 people they'd normally be back 3 days later
+	if next.Sub(christmas.Start()) <= 3*24*time.Hour {
+		t.Fatalf("Whoever works christmas should wait longer for their next shift, %v is back on %v", worker, next)
+	}
+
+	holidayCmd(command{action: "holiday", args: []string{"remove", "dec", "25"}}, s)
+	if len(s.Holidays) != 1 {
+		t.Fatalf("dec 25 isn't a date, so nothing should have been removed")
+	}
+	holidayCmd(command{action: "holiday", args: []string{"remove", "2015-12-25"}}, s)
+	if len(s.Holidays) != 0 {
+		t.Fatalf("Christmas should have been removed: %v", s.Holidays)
+	}
+}